@@ -1,25 +1,53 @@
 package main
 
 import (
+	"context"
 	"fmt"
-	"log"      // стандартный логгер Go для вывода в консоль.
+	"log" // стандартный логгер Go для вывода в консоль.
+	"net"
 	"net/http" // стандартная клиент-серверная HTTP-библиотека
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/quizverse3D/Backend/internal/authgateway" // бизнес-логика
 	"github.com/quizverse3D/Backend/internal/common"      // БД
+	authPb "github.com/quizverse3D/Backend/internal/pb/auth"
+	roomPb "github.com/quizverse3D/Backend/internal/pb/room"
+	userPb "github.com/quizverse3D/Backend/internal/pb/user"
 	"github.com/streadway/amqp"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"google.golang.org/grpc"
 )
 
+// сколько REST-сервер ждёт завершения текущих запросов при остановке
+const shutdownTimeout = 10 * time.Second
+
 func main() {
 	// .env
 	if err := godotenv.Load(); err != nil {
 		log.Println(".env file not found, using system env")
 	}
 
+	// OpenTelemetry
+	shutdownTracing, err := common.InitTracing("authgateway")
+	if err != nil {
+		log.Fatalf("failed to init tracing: %v", err)
+	}
+	defer shutdownTracing(context.Background())
+
 	mux := http.NewServeMux()
 
+	// JWT signing keys
+	keySet, err := authgateway.LoadKeySetFromEnv()
+	if err != nil {
+		log.Fatal("Failed to load JWT signing keys:", err)
+	}
+	authgateway.SetKeySet(keySet)
+
 	// PostgreSQL
 	pool, err := common.NewPostgresPool(
 		os.Getenv("AUTHGATEWAY_DB_USER"),
@@ -49,10 +77,37 @@ func main() {
 		log.Fatalf("failed to open RabbitMQ channel: %v", err)
 	}
 	defer rabbitChan.Close()
+	if err := common.DeclareFanoutExchange(rabbitChan, "user_deleted"); err != nil {
+		log.Fatalf("failed to declare exchange: %v", err)
+	}
+
+	// Mail
+	mailer, err := common.NewMailerFromEnv()
+	if err != nil {
+		log.Fatalf("failed to create mailer: %v", err)
+	}
+
+	// Config
+	cfg, err := authgateway.ConfigFromEnv()
+	if err != nil {
+		log.Fatalf("invalid authgateway config: %v", err)
+	}
 
 	// Service and Storage
-	authService := authgateway.NewService(authgateway.NewStorage(pool), redisClient, rabbitChan) // структура со включенным в себя Storage
-	handler := authgateway.NewHandler(authService)                                               // структура-обёртка вокруг authService
+	storage := authgateway.NewStorage(pool)
+
+	// Outbox relay: события из таблицы outbox публикуются в RabbitMQ с подтверждением
+	outboxRelay, err := authgateway.NewOutboxRelay(storage, rabbitConn)
+	if err != nil {
+		log.Fatalf("failed to create outbox relay: %v", err)
+	}
+	// SIGTERM от Kubernetes: relay, REST и gRPC останавливаются, дожидаясь текущих запросов
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go outboxRelay.Run(ctx)
+
+	authService := authgateway.NewService(storage, redisClient, outboxRelay, mailer, cfg) // структура со включенным в себя Storage
+	handler := authgateway.NewHandler(authService)                                        // структура-обёртка вокруг authService
 
 	// привязка url'ов к обработчикам REST-сервиса
 	mux.HandleFunc("/auth/api/v1/register", handler.Register)
@@ -60,28 +115,100 @@ func main() {
 	mux.HandleFunc("/auth/api/v1/validate-token", handler.ValidateToken)
 	mux.HandleFunc("/auth/api/v1/refresh-token", handler.RefreshAccessToken)
 	mux.HandleFunc("/auth/api/v1/update-password", handler.UpdatePassword)
+	mux.HandleFunc("/auth/api/v1/logout", handler.Logout)
+	mux.HandleFunc("/auth/api/v1/logout-all", handler.LogoutAll)
+	mux.HandleFunc("/auth/api/v1/verify-email", handler.VerifyEmail)
+	mux.HandleFunc("/auth/api/v1/verify-email/resend", handler.ResendVerificationEmail)
+	mux.HandleFunc("/auth/api/v1/password/forgot", handler.ForgotPassword)
+	mux.HandleFunc("/auth/api/v1/password/reset", handler.ResetPassword)
+	mux.HandleFunc("/auth/api/v1/login/mfa", handler.LoginMFA)
+	mux.HandleFunc("/auth/api/v1/mfa/enroll", handler.EnrollMFA)
+	mux.HandleFunc("/auth/api/v1/mfa/confirm", handler.ConfirmMFA)
+	mux.HandleFunc("/auth/api/v1/mfa/disable", handler.DisableMFA)
+	mux.HandleFunc("/auth/api/v1/guest", handler.Guest)
+	mux.HandleFunc("/auth/api/v1/guest/upgrade", handler.UpgradeGuest)
+	mux.HandleFunc("/auth/api/v1/account", handler.DeleteAccount)
+	mux.HandleFunc("/auth/api/v1/api-keys", handler.APIKeys)
+	mux.HandleFunc("/auth/api/v1/api-keys/{id}", handler.RevokeAPIKey)
+	mux.HandleFunc("/auth/api/v1/sessions", handler.Sessions)
+	mux.HandleFunc("/auth/api/v1/sessions/{id}", handler.RevokeSession)
+	mux.Handle("/auth/api/v1/admin/audit", handler.AuthMiddleWare(authgateway.RequireRoles(http.HandlerFunc(handler.Audit), common.RoleAdmin)))
+	mux.Handle("/auth/api/v1/admin/roles", handler.AuthMiddleWare(authgateway.RequireRoles(http.HandlerFunc(handler.SetRoles), common.RoleAdmin)))
+	mux.HandleFunc("/auth/.well-known/jwks.json", handler.JWKS)
 
 	// привязка gRPC-сервисов для маршрутизации
 	grpcUserAddr := fmt.Sprintf("%s:%s", os.Getenv("USERS_GRPC_HOST"), os.Getenv("USERS_GRPC_PORT"))
 	userRestPrefix := "/user/api/v1/"
-	userRoute, err := authgateway.NewUserGrpcServiceRoute(grpcUserAddr, userRestPrefix)
+	userRoute, err := authgateway.NewGrpcServiceRoute(grpcUserAddr, userRestPrefix, "user", userPb.UserService_ServiceDesc.ServiceName, authgateway.RoutePolicies)
 	if err != nil {
 		log.Fatalf("failed to create userRoute: %v", err)
 	}
 	defer userRoute.Conn.Close()
-	mux.Handle(userRestPrefix, authgateway.AuthMiddleWare(authgateway.ProxyHandler(userRoute)))
+	mux.Handle(userRestPrefix, handler.ServiceRouteHandler(userRoute))
 
 	grpcRoomAddr := fmt.Sprintf("%s:%s", os.Getenv("ROOMS_GRPC_HOST"), os.Getenv("ROOMS_GRPC_PORT"))
 	roomRestPrefix := "/room/api/v1/"
-	roomRoute, err := authgateway.NewRoomGrpcServiceRoute(grpcRoomAddr, roomRestPrefix)
+	roomRoute, err := authgateway.NewGrpcServiceRoute(grpcRoomAddr, roomRestPrefix, "rooms", roomPb.RoomService_ServiceDesc.ServiceName, authgateway.RoutePolicies)
 	if err != nil {
 		log.Fatalf("failed to create roomRoute: %v", err)
 	}
 	defer roomRoute.Conn.Close()
-	mux.Handle(roomRestPrefix, authgateway.AuthMiddleWare(authgateway.ProxyHandler(roomRoute)))
+	mux.Handle(roomRestPrefix, handler.ServiceRouteHandler(roomRoute))
+
+	// пробы Kubernetes: /healthz — процесс жив, /readyz — доступны БД, Redis, RabbitMQ и gRPC-сервисы
+	healthChecker := common.NewHealthChecker(
+		common.PostgresHealthCheck(pool),
+		common.RedisHealthCheck(redisClient),
+		common.RabbitMQHealthCheck(rabbitConn),
+		common.GRPCHealthCheck("user", userRoute.Conn),
+		common.GRPCHealthCheck("room", roomRoute.Conn),
+	)
+	go healthChecker.Run(ctx, common.HealthCheckInterval)
+	mux.HandleFunc("/healthz", common.LivenessHandler)
+	mux.HandleFunc("/readyz", healthChecker.ReadinessHandler)
+
+	// внутренний gRPC AuthService: проверка токенов для остальных сервисов
+	grpcMetrics := common.NewGRPCServerMetrics()
+	grpcServer := grpc.NewServer(
+		grpc.StatsHandler(otelgrpc.NewServerHandler()),
+		grpc.ChainUnaryInterceptor(grpcMetrics.UnaryServerInterceptor(), common.RequestIDUnaryInterceptor()),
+	)
+	authPb.RegisterAuthServiceServer(grpcServer, authgateway.NewGRPCServer(authService))
+	grpcMetrics.InitializeMetrics(grpcServer)
+	listener, err := net.Listen("tcp", ":"+os.Getenv("AUTHGATEWAY_GRPC_PORT"))
+	if err != nil {
+		log.Fatalf("failed to listen: %v", err)
+	}
+	go func() {
+		log.Println("Authgateway gRPC-service running on " + os.Getenv("AUTHGATEWAY_GRPC_PORT"))
+		if err := grpcServer.Serve(listener); err != nil {
+			log.Fatalf("failed to serve: %v", err)
+		}
+	}()
+
+	// Prometheus
+	common.ServeMetrics(os.Getenv("AUTHGATEWAY_METRICS_PORT"))
 
 	// REST Server listening (в конце)
 	restPort := fmt.Sprintf(":%s", os.Getenv("AUTHGATEWAY_REST_PORT"))
 	log.Println("Authgateway REST-Service running on " + restPort)
-	log.Fatal(http.ListenAndServe(restPort, mux))
+	// серверный спан на каждый запрос; ProxyHandler переименовывает его по шаблону маршрута
+	httpHandler := otelhttp.NewHandler(authgateway.RequestIDMiddleWare(authgateway.MetricsMiddleWare(mux)), "authgateway",
+		otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string { return r.Method + " " + r.URL.Path }),
+	)
+	server := &http.Server{Addr: restPort, Handler: httpHandler}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("failed to serve REST: %v", err)
+		}
+	}()
+
+	<-ctx.Done()
+	log.Println("shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("failed to shut down REST server: %v", err)
+	}
+	grpcServer.GracefulStop()
 }
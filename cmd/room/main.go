@@ -2,24 +2,37 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"net"
 	"os"
+	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/quizverse3D/Backend/internal/common"
 	pb "github.com/quizverse3D/Backend/internal/pb/room"
 	"github.com/quizverse3D/Backend/internal/room"
 	"github.com/streadway/amqp"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"google.golang.org/grpc"
 )
 
+// завершённая сессия может действовать в сервисе ещё столько же
+const authCacheTTL = 10 * time.Second
+
 func main() {
 	// .env
 	if err := godotenv.Load(); err != nil {
 		log.Println(".env file not found, using system env")
 	}
 
+	// OpenTelemetry
+	shutdownTracing, err := common.InitTracing("room")
+	if err != nil {
+		log.Fatalf("failed to init tracing: %v", err)
+	}
+	defer shutdownTracing(context.Background())
+
 	// PostgreSQL
 	pool, err := common.NewPostgresPool(
 		os.Getenv("ROOMS_DB_USER"),
@@ -51,20 +64,54 @@ func main() {
 	defer rabbitChan.Close()
 
 	// Service and Storage
+	passwordParams, err := common.PasswordParamsFromEnv()
+	if err != nil {
+		log.Fatalf("invalid password hashing config: %v", err)
+	}
+
 	storage := room.NewStorage(pool)
-	service := room.NewService(storage, redisClient)
+	service := room.NewService(storage, redisClient, common.NewPasswordHasher(passwordParams))
+
+	// проверка токенов, переданных gateway, через AuthService.Introspect
+	authAddr := fmt.Sprintf("%s:%s", os.Getenv("AUTHGATEWAY_GRPC_HOST"), os.Getenv("AUTHGATEWAY_GRPC_PORT"))
+	authClient, err := common.NewAuthClient(authAddr, authCacheTTL)
+	if err != nil {
+		log.Fatalf("failed to create auth client: %v", err)
+	}
+	defer authClient.Close()
 
 	// gRPC Server
-	grpcServer := grpc.NewServer()
+	grpcMetrics := common.NewGRPCServerMetrics()
+	grpcServer := grpc.NewServer(grpc.StatsHandler(otelgrpc.NewServerHandler()), grpc.ChainUnaryInterceptor(
+		grpcMetrics.UnaryServerInterceptor(),
+		common.RequestIDUnaryInterceptor(),
+		common.AuthUnaryInterceptor(authClient),
+		common.ErrorStatusUnaryInterceptor("room", room.ErrorStatuses),
+	))
 	pb.RegisterRoomServiceServer(grpcServer, room.NewGRPCServer(service))
 
+	// grpc.health.v1 для проб Kubernetes: NOT_SERVING, пока недоступна любая из зависимостей
+	healthChecker := common.NewHealthChecker(
+		common.PostgresHealthCheck(pool),
+		common.RedisHealthCheck(redisClient),
+		common.RabbitMQHealthCheck(rabbitConn),
+	)
+	common.RegisterGRPCHealth(grpcServer, healthChecker, pb.RoomService_ServiceDesc.ServiceName)
+	go healthChecker.Run(context.Background(), common.HealthCheckInterval)
+	grpcMetrics.InitializeMetrics(grpcServer)
+
+	// Prometheus
+	common.ServeMetrics(os.Getenv("ROOMS_METRICS_PORT"))
+
 	listener, err := net.Listen("tcp", ":"+os.Getenv("ROOMS_GRPC_PORT"))
 	if err != nil {
 		log.Fatalf("failed to listen: %v", err)
 	}
 
 	// регистрация rabbitmq consumer'ов
-	consumers := []common.Consumer{}
+	consumers := []common.Consumer{
+		*common.NewExchangeConsumer(rabbitConn, rabbitChan, "user_deleted", "room.user_deleted", room.UserDeletedHandler(service)),
+	}
 
 	for _, c := range consumers {
 		if err := c.DeclareQueue(); err != nil {
@@ -2,24 +2,37 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"net"
 	"os"
+	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/quizverse3D/Backend/internal/common"
 	pb "github.com/quizverse3D/Backend/internal/pb/user"
 	"github.com/quizverse3D/Backend/internal/user"
 	"github.com/streadway/amqp"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"google.golang.org/grpc"
 )
 
+// завершённая сессия может действовать в сервисе ещё столько же
+const authCacheTTL = 10 * time.Second
+
 func main() {
 	// .env
 	if err := godotenv.Load(); err != nil {
 		log.Println(".env file not found, using system env")
 	}
 
+	// OpenTelemetry
+	shutdownTracing, err := common.InitTracing("user")
+	if err != nil {
+		log.Fatalf("failed to init tracing: %v", err)
+	}
+	defer shutdownTracing(context.Background())
+
 	// PostgreSQL
 	pool, err := common.NewPostgresPool(
 		os.Getenv("USERS_DB_USER"),
@@ -54,10 +67,37 @@ func main() {
 	storage := user.NewStorage(pool)
 	service := user.NewService(storage, redisClient)
 
+	// проверка токенов, переданных gateway, через AuthService.Introspect
+	authAddr := fmt.Sprintf("%s:%s", os.Getenv("AUTHGATEWAY_GRPC_HOST"), os.Getenv("AUTHGATEWAY_GRPC_PORT"))
+	authClient, err := common.NewAuthClient(authAddr, authCacheTTL)
+	if err != nil {
+		log.Fatalf("failed to create auth client: %v", err)
+	}
+	defer authClient.Close()
+
 	// gRPC Server
-	grpcServer := grpc.NewServer()
+	grpcMetrics := common.NewGRPCServerMetrics()
+	grpcServer := grpc.NewServer(grpc.StatsHandler(otelgrpc.NewServerHandler()), grpc.ChainUnaryInterceptor(
+		grpcMetrics.UnaryServerInterceptor(),
+		common.RequestIDUnaryInterceptor(),
+		common.AuthUnaryInterceptor(authClient),
+		common.ErrorStatusUnaryInterceptor("user", user.ErrorStatuses),
+	))
 	pb.RegisterUserServiceServer(grpcServer, user.NewGRPCServer(service))
 
+	// grpc.health.v1 для проб Kubernetes: NOT_SERVING, пока недоступна любая из зависимостей
+	healthChecker := common.NewHealthChecker(
+		common.PostgresHealthCheck(pool),
+		common.RedisHealthCheck(redisClient),
+		common.RabbitMQHealthCheck(rabbitConn),
+	)
+	common.RegisterGRPCHealth(grpcServer, healthChecker, pb.UserService_ServiceDesc.ServiceName)
+	go healthChecker.Run(context.Background(), common.HealthCheckInterval)
+	grpcMetrics.InitializeMetrics(grpcServer)
+
+	// Prometheus
+	common.ServeMetrics(os.Getenv("USERS_METRICS_PORT"))
+
 	listener, err := net.Listen("tcp", ":"+os.Getenv("USERS_GRPC_PORT"))
 	if err != nil {
 		log.Fatalf("failed to listen: %v", err)
@@ -65,7 +105,8 @@ func main() {
 
 	// регистрация rabbitmq consumer'ов
 	consumers := []common.Consumer{
-		*common.NewConsumer(rabbitChan, "user_registered", user.UserRegisteredHandler(service)),
+		*common.NewConsumer(rabbitConn, rabbitChan, "user_registered", user.UserRegisteredHandler(service)),
+		*common.NewExchangeConsumer(rabbitConn, rabbitChan, "user_deleted", "user.user_deleted", user.UserDeletedHandler(service)),
 	}
 
 	for _, c := range consumers {
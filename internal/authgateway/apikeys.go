@@ -0,0 +1,148 @@
+package authgateway
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/quizverse3D/Backend/internal/common"
+)
+
+// ключи отличаются от JWT префиксом и передаются так же: Authorization: Bearer qv_...
+const (
+	apiKeyPrefix        = "qv_"
+	apiKeyDisplayLength = len(apiKeyPrefix) + 8
+	apiKeyNameMaxLength = 64
+	maxAPIKeysPerUser   = 20
+	apiKeyTouchInterval = time.Minute // как часто обновляется last_used_at
+)
+
+// права API-ключа: <ресурс>:read для GET-запросов к проксируемому сервису, <ресурс>:write для остальных
+const (
+	ScopeUserRead   = "user:read"
+	ScopeUserWrite  = "user:write"
+	ScopeRoomsRead  = "rooms:read"
+	ScopeRoomsWrite = "rooms:write"
+)
+
+var KnownScopes = []string{ScopeUserRead, ScopeUserWrite, ScopeRoomsRead, ScopeRoomsWrite}
+
+type NewAPIKey struct {
+	APIKey
+	Key string `json:"key"`
+}
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func isAPIKey(token string) bool {
+	return strings.HasPrefix(token, apiKeyPrefix)
+}
+
+// ключ возвращается только здесь; expiresIn == 0 — бессрочный
+func (s *Service) CreateAPIKey(userID, name string, scopes []string, expiresIn time.Duration, client ClientInfo) (key NewAPIKey, err error) {
+	defer func() {
+		s.audit(AuditEntry{Event: AuditAPIKeyCreate, UserID: userID, Details: key.ID}, client, err)
+	}()
+
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > apiKeyNameMaxLength {
+		return NewAPIKey{}, ErrInvalidAPIKeyName
+	}
+	if len(scopes) == 0 {
+		return NewAPIKey{}, ErrInvalidScopes
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(KnownScopes, scope) {
+			return NewAPIKey{}, ErrInvalidScopes
+		}
+	}
+
+	ctx := client.context()
+	u, err := s.storage.GetCredInfoByUuid(ctx, userID)
+	if err != nil {
+		return NewAPIKey{}, err
+	}
+	if u.Guest {
+		return NewAPIKey{}, ErrGuestNotAllowed
+	}
+	if s.isLimited(u) {
+		return NewAPIKey{}, ErrEmailNotVerified
+	}
+
+	existing, err := s.storage.ListAPIKeys(ctx, userID)
+	if err != nil {
+		return NewAPIKey{}, err
+	}
+	if len(existing) >= maxAPIKeysPerUser {
+		return NewAPIKey{}, ErrTooManyAPIKeys
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return NewAPIKey{}, err
+	}
+	secret := apiKeyPrefix + base64.RawURLEncoding.EncodeToString(b)
+
+	k := APIKey{
+		ID:        uuid.NewString(),
+		UserID:    userID,
+		Name:      name,
+		Prefix:    secret[:apiKeyDisplayLength],
+		KeyHash:   hashAPIKey(secret),
+		Scopes:    slices.Compact(slices.Sorted(slices.Values(scopes))),
+		CreatedAt: time.Now().UTC(),
+	}
+	if expiresIn > 0 {
+		expiresAt := k.CreatedAt.Add(expiresIn)
+		k.ExpiresAt = &expiresAt
+	}
+
+	if err := s.storage.CreateAPIKey(ctx, k); err != nil {
+		return NewAPIKey{}, err
+	}
+	return NewAPIKey{APIKey: k, Key: secret}, nil
+}
+
+func (s *Service) ListAPIKeys(ctx context.Context, userID string) ([]APIKey, error) {
+	return s.storage.ListAPIKeys(ctx, userID)
+}
+
+func (s *Service) RevokeAPIKey(userID, keyID string, client ClientInfo) (err error) {
+	defer func() { s.audit(AuditEntry{Event: AuditAPIKeyRevoke, UserID: userID, Details: keyID}, client, err) }()
+
+	if _, err := uuid.Parse(keyID); err != nil {
+		return ErrAPIKeyNotFound
+	}
+	return s.storage.DeleteAPIKey(client.context(), userID, keyID)
+}
+
+// владелец и права ключа; используется в AuthMiddleWare вместо проверки JWT
+func (s *Service) AuthenticateAPIKey(ctx context.Context, key string) (APIKey, error) {
+	k, ok, err := s.storage.GetAPIKeyByHash(ctx, hashAPIKey(key))
+	if err != nil {
+		return APIKey{}, err
+	}
+	if !ok {
+		return APIKey{}, ErrInvalidAPIKey
+	}
+	if k.ExpiresAt != nil && time.Now().After(*k.ExpiresAt) {
+		return APIKey{}, ErrInvalidAPIKey
+	}
+
+	// last_used_at нужен с точностью до минуты, UPDATE на каждый запрос не нужен
+	if k.LastUsedAt == nil || time.Since(*k.LastUsedAt) > apiKeyTouchInterval {
+		if err := s.storage.TouchAPIKey(ctx, k.ID); err != nil {
+			common.Logf(ctx, "failed to update api key %s usage: %v", k.ID, err)
+		}
+	}
+	return k, nil
+}
@@ -0,0 +1,108 @@
+package authgateway
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/quizverse3D/Backend/internal/common"
+)
+
+// события журнала аудита
+const (
+	AuditRegister       = "register"
+	AuditVerifyEmail    = "verify-email"
+	AuditVerifyResend   = "verify-email-resend"
+	AuditLogin          = "login"
+	AuditLoginMFA       = "login-mfa"
+	AuditRefresh        = "refresh"
+	AuditLogout         = "logout"
+	AuditLogoutAll      = "logout-all"
+	AuditSessionRevoke  = "session-revoke"
+	AuditPasswordUpdate = "password-update"
+	AuditPasswordForgot = "password-forgot"
+	AuditPasswordReset  = "password-reset"
+	AuditMFAEnroll      = "mfa-enroll"
+	AuditMFAEnable      = "mfa-enable"
+	AuditMFADisable     = "mfa-disable"
+	AuditGuestCreate    = "guest-create"
+	AuditGuestUpgrade   = "guest-upgrade"
+	AuditAccountDelete  = "account-delete"
+	AuditAPIKeyCreate   = "api-key-create"
+	AuditAPIKeyRevoke   = "api-key-revoke"
+	AuditRolesUpdate    = "roles-update"
+)
+
+const (
+	AuditSuccess     = "success"
+	AuditFailure     = "failure"
+	AuditMFARequired = "mfa_required"
+)
+
+const (
+	auditDefaultLimit = 100
+	auditMaxLimit     = 1000
+)
+
+type AuditEntry struct {
+	ID         int64     `json:"id"`
+	OccurredAt time.Time `json:"occurred_at"`
+	Event      string    `json:"event"`
+	Outcome    string    `json:"outcome"`
+	UserID     string    `json:"user_id,omitempty"`
+	Email      string    `json:"email,omitempty"` // для входа с неизвестной почтой, когда UserID нет
+	IP         string    `json:"ip"`
+	UserAgent  string    `json:"user_agent"`
+	Details    string    `json:"details,omitempty"` // причина отказа или параметры операции
+}
+
+// фильтры выборки; пустые поля не ограничивают. Записи идут от новых к старым,
+// BeforeID — ID последней записи предыдущей страницы
+type AuditFilter struct {
+	UserID   string
+	Event    string
+	From     *time.Time
+	To       *time.Time
+	BeforeID int64
+	Limit    int
+}
+
+// запись события; ошибка записи не должна ломать саму операцию
+func (s *Service) audit(e AuditEntry, client ClientInfo, err error) {
+	e.IP = client.IP
+	e.UserAgent = client.UserAgent
+	if len(e.UserAgent) > maxUserAgentLength {
+		e.UserAgent = e.UserAgent[:maxUserAgentLength]
+	}
+
+	var mfaErr *MFARequiredError
+	switch {
+	case err == nil:
+		e.Outcome = AuditSuccess
+	case errors.As(err, &mfaErr):
+		e.Outcome = AuditMFARequired
+	default:
+		e.Outcome = AuditFailure
+		if e.Details == "" {
+			e.Details = err.Error()
+		} else {
+			e.Details += ": " + err.Error()
+		}
+	}
+
+	authEvents.WithLabelValues(e.Event, e.Outcome).Inc()
+
+	if err := s.storage.InsertAudit(client.context(), e); err != nil {
+		common.Logf(client.context(), "failed to write audit %s for %s: %v", e.Event, e.UserID, err)
+	}
+}
+
+func (s *Service) QueryAudit(ctx context.Context, filter AuditFilter) ([]AuditEntry, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = auditDefaultLimit
+	}
+	if filter.Limit > auditMaxLimit {
+		filter.Limit = auditMaxLimit
+	}
+	return s.storage.QueryAudit(ctx, filter)
+}
@@ -0,0 +1,151 @@
+package authgateway
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/quizverse3D/Backend/internal/common"
+)
+
+// что делать при входе с неподтверждённой почтой
+type LoginPolicy string
+
+const (
+	LoginPolicyAllow   LoginPolicy = "allow"   // вход без ограничений
+	LoginPolicyLimited LoginPolicy = "limited" // вход разрешён, но проксируемые сервисы недоступны до подтверждения
+	LoginPolicyDeny    LoginPolicy = "deny"    // вход запрещён до подтверждения
+)
+
+type Config struct {
+	UnverifiedLoginPolicy LoginPolicy
+	VerifyEmailURL        string // ссылка из письма, к ней добавляется ?token=...
+	ResetPasswordURL      string // страница клиента для ввода нового пароля, к ней добавляется ?token=...
+	RateLimits            map[string]EndpointLimits
+	Lockout               LockoutConfig
+	RouteRateLimit        Limit          // квота REST → gRPC маршрута без собственного RoutePolicy.RateLimit
+	TrustedProxies        []netip.Prefix // адреса ingress/балансировщиков, которым доверяются X-Forwarded-For / X-Real-IP
+	MFAEncryptionKey      []byte         // AES-256 ключ для TOTP-секретов; без него 2FA недоступна
+	PasswordParams        common.PasswordParams
+}
+
+func ConfigFromEnv() (Config, error) {
+	cfg := Config{
+		UnverifiedLoginPolicy: LoginPolicy(os.Getenv("UNVERIFIED_LOGIN_POLICY")),
+		VerifyEmailURL:        os.Getenv("VERIFY_EMAIL_URL"),
+		ResetPasswordURL:      os.Getenv("RESET_PASSWORD_URL"),
+		RateLimits:            defaultRateLimits(),
+		Lockout:               defaultLockout(),
+		RouteRateLimit:        Limit{Requests: 120, Window: time.Minute},
+	}
+
+	switch cfg.UnverifiedLoginPolicy {
+	case "":
+		cfg.UnverifiedLoginPolicy = LoginPolicyAllow
+	case LoginPolicyAllow, LoginPolicyLimited, LoginPolicyDeny:
+	default:
+		return Config{}, fmt.Errorf("unknown UNVERIFIED_LOGIN_POLICY %q", cfg.UnverifiedLoginPolicy)
+	}
+
+	if cfg.VerifyEmailURL == "" {
+		cfg.VerifyEmailURL = "http://localhost:" + os.Getenv("AUTHGATEWAY_REST_PORT") + "/auth/api/v1/verify-email"
+	}
+
+	if cfg.ResetPasswordURL == "" {
+		cfg.ResetPasswordURL = "http://localhost/reset-password"
+	}
+
+	// RATE_LIMIT_<ENDPOINT>_IP / RATE_LIMIT_<ENDPOINT>_ACCOUNT, например RATE_LIMIT_LOGIN_IP=20/1m
+	for endpoint, limits := range cfg.RateLimits {
+		prefix := "RATE_LIMIT_" + strings.ToUpper(strings.ReplaceAll(endpoint, "-", "_"))
+		if raw := os.Getenv(prefix + "_IP"); raw != "" {
+			limit, err := parseLimit(raw)
+			if err != nil {
+				return Config{}, err
+			}
+			limits.PerIP = limit
+		}
+		if raw := os.Getenv(prefix + "_ACCOUNT"); raw != "" {
+			limit, err := parseLimit(raw)
+			if err != nil {
+				return Config{}, err
+			}
+			limits.PerAccount = limit
+		}
+		cfg.RateLimits[endpoint] = limits
+	}
+
+	if raw := os.Getenv("RATE_LIMIT_ROUTE_DEFAULT"); raw != "" {
+		limit, err := parseLimit(raw)
+		if err != nil {
+			return Config{}, err
+		}
+		cfg.RouteRateLimit = limit
+	}
+
+	// TRUSTED_PROXIES — CIDR через запятую, например 10.0.0.0/8,172.16.0.0/12
+	if raw := os.Getenv("TRUSTED_PROXIES"); raw != "" {
+		for _, item := range strings.Split(raw, ",") {
+			prefix, err := parseTrustedProxy(strings.TrimSpace(item))
+			if err != nil {
+				return Config{}, fmt.Errorf("invalid TRUSTED_PROXIES entry %q", item)
+			}
+			cfg.TrustedProxies = append(cfg.TrustedProxies, prefix)
+		}
+	}
+
+	passwordParams, err := common.PasswordParamsFromEnv()
+	if err != nil {
+		return Config{}, err
+	}
+	cfg.PasswordParams = passwordParams
+
+	// MFA_ENCRYPTION_KEY — 32 байта в base64
+	if raw := os.Getenv("MFA_ENCRYPTION_KEY"); raw != "" {
+		key, err := base64.StdEncoding.DecodeString(raw)
+		if err != nil || len(key) != 32 {
+			return Config{}, fmt.Errorf("MFA_ENCRYPTION_KEY must be 32 bytes in base64")
+		}
+		cfg.MFAEncryptionKey = key
+	}
+
+	if raw := os.Getenv("LOCKOUT_THRESHOLD"); raw != "" {
+		threshold, err := strconv.Atoi(raw)
+		if err != nil || threshold < 0 {
+			return Config{}, fmt.Errorf("invalid LOCKOUT_THRESHOLD %q", raw)
+		}
+		cfg.Lockout.Threshold = threshold
+	}
+	for env, target := range map[string]*time.Duration{
+		"LOCKOUT_WINDOW": &cfg.Lockout.Window,
+		"LOCKOUT_BASE":   &cfg.Lockout.Base,
+		"LOCKOUT_MAX":    &cfg.Lockout.Max,
+	} {
+		if raw := os.Getenv(env); raw != "" {
+			d, err := time.ParseDuration(raw)
+			if err != nil || d <= 0 {
+				return Config{}, fmt.Errorf("invalid %s %q", env, raw)
+			}
+			*target = d
+		}
+	}
+
+	return cfg, nil
+}
+
+// CIDR или отдельный адрес
+func parseTrustedProxy(raw string) (netip.Prefix, error) {
+	if strings.Contains(raw, "/") {
+		prefix, err := netip.ParsePrefix(raw)
+		return prefix.Masked(), err
+	}
+	addr, err := netip.ParseAddr(raw)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()), nil
+}
@@ -3,7 +3,26 @@ package authgateway
 import "errors"
 
 var (
-	ErrUserExists      = errors.New("user already exists")
-	ErrInvalidCreds    = errors.New("invalid credentials")
-	ErrInvalidPassword = errors.New("invalid password")
+	ErrUserExists               = errors.New("user already exists")
+	ErrInvalidCreds             = errors.New("invalid credentials")
+	ErrInvalidPassword          = errors.New("invalid password")
+	ErrRefreshReused            = errors.New("refresh token reuse detected")
+	ErrInvalidEmail             = errors.New("invalid email")
+	ErrEmailNotVerified         = errors.New("email is not verified")
+	ErrInvalidVerificationToken = errors.New("invalid or used verification token")
+	ErrInvalidResetToken        = errors.New("invalid or used password reset token")
+	ErrMFANotConfigured         = errors.New("mfa is not configured on server")
+	ErrMFAAlreadyEnabled        = errors.New("mfa is already enabled")
+	ErrMFANotEnrolled           = errors.New("mfa is not enrolled")
+	ErrInvalidMFACode           = errors.New("invalid mfa code")
+	ErrNotGuest                 = errors.New("account is not a guest")
+	ErrGuestNotAllowed          = errors.New("not available for guest accounts")
+	ErrInvalidRoles             = errors.New("invalid roles")
+	ErrUserNotFound             = errors.New("user not found")
+	ErrInvalidScopes            = errors.New("invalid scopes")
+	ErrAPIKeyNotFound           = errors.New("api key not found")
+	ErrInvalidAPIKey            = errors.New("invalid api key")
+	ErrInvalidAPIKeyName        = errors.New("api key name must be 1-64 characters")
+	ErrSessionNotFound          = errors.New("session not found")
+	ErrTooManyAPIKeys           = errors.New("too many api keys")
 )
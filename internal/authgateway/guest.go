@@ -0,0 +1,52 @@
+package authgateway
+
+import (
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/quizverse3D/Backend/internal/common"
+)
+
+// анонимный аккаунт для игры без регистрации; профиль в Users создаётся тем же событием user_registered
+func (s *Service) CreateGuest(client ClientInfo) (accessToken, refreshToken string, err error) {
+	id := uuid.NewString()
+	defer func() { s.audit(AuditEntry{Event: AuditGuestCreate, UserID: id}, client, err) }()
+
+	username := "guest_" + strings.ReplaceAll(id, "-", "")[:8]
+	event, err := userRegisteredEvent(client.context(), id, username)
+	if err != nil {
+		return "", "", err
+	}
+
+	if err := s.storage.CreateGuest(client.context(), id, event); err != nil {
+		return "", "", err
+	}
+	s.outbox.Notify()
+
+	return s.createSession(client.context(), Auth{ID: id, Guest: true, Roles: []string{common.RoleUser}}, client)
+}
+
+// превращение гостя в полноценный аккаунт: UUID сохраняется вместе с комнатами и статистикой
+func (s *Service) UpgradeGuest(userID, email, password string, client ClientInfo) (err error) {
+	defer func() { s.audit(AuditEntry{Event: AuditGuestUpgrade, UserID: userID, Email: email}, client, err) }()
+
+	if !isValidEmail(email) {
+		return ErrInvalidEmail
+	}
+
+	hashed, err := s.hasher.Hash(password)
+	if err != nil {
+		return err
+	}
+
+	err = s.storage.UpgradeGuest(client.context(), Auth{ID: userID, Email: email, Password: hashed})
+	if err != nil {
+		return err
+	}
+
+	if err := s.sendVerificationEmail(client.context(), userID, email); err != nil {
+		common.Logf(client.context(), "failed to send verification email to %s: %v", email, err)
+	}
+
+	return nil
+}
@@ -1,9 +1,16 @@
 package authgateway
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/quizverse3D/Backend/internal/common"
 )
 
 type Handler struct {
@@ -14,6 +21,19 @@ func NewHandler(svc *Service) *Handler {
 	return &Handler{svc: svc}
 }
 
+func (h *Handler) clientIP(r *http.Request) string {
+	return clientIP(r, h.svc.cfg.TrustedProxies)
+}
+
+func (h *Handler) clientInfo(r *http.Request) ClientInfo {
+	return ClientInfo{
+		IP:        h.clientIP(r),
+		UserAgent: r.UserAgent(),
+		// операция доводится до конца, даже если клиент закрыл соединение
+		ctx: context.WithoutCancel(r.Context()),
+	}
+}
+
 type Credentials struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
@@ -38,12 +58,28 @@ func (h *Handler) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err := h.svc.Register(creds.Email, creds.Password, creds.UserName)
-	if err != nil {
-		// ошибка регистрации
+	if err := h.svc.CheckRateLimit(r.Context(), EndpointRegister, h.clientIP(r), creds.Email); err != nil {
+		if !writeRateLimitError(w, err) {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	_, err := h.svc.Register(creds.Email, creds.Password, creds.UserName, h.clientInfo(r))
+	if err == ErrInvalidEmail {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	if err == ErrUserExists {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		// текст ошибок БД клиенту не отдаётся
+		common.Logf(r.Context(), "failed to register %s: %v", creds.Email, err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
 
 	w.WriteHeader(http.StatusCreated)
 	w.Write([]byte("registered"))
@@ -67,22 +103,42 @@ func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	accessToken, refreshToken, err := h.svc.Login(creds.Email, creds.Password)
+	client := h.clientInfo(r)
+	if err := h.svc.CheckRateLimit(r.Context(), EndpointLogin, client.IP, creds.Email); err != nil {
+		if !writeRateLimitError(w, err) {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	accessToken, refreshToken, err := h.svc.Login(creds.Email, creds.Password, client)
+	if writeRateLimitError(w, err) {
+		return
+	}
+	var mfaErr *MFARequiredError
+	if errors.As(err, &mfaErr) {
+		// второй шаг — /auth/api/v1/login/mfa
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]string{"mfa_token": mfaErr.Token})
+		return
+	}
+	if err == ErrEmailNotVerified {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if err == ErrInvalidCreds {
+		// одинаковый ответ для неизвестной почты и неверного пароля
+		http.Error(w, "invalid credentials", http.StatusUnauthorized)
+		return
+	}
 	if err != nil {
-		// ошибка авторизации
-		http.Error(w, err.Error(), http.StatusUnauthorized)
+		// текст внутренней ошибки клиенту не отдаётся, аудит записан в сервисе
+		http.Error(w, "internal server error", http.StatusInternalServerError)
 		return
 	}
 
-	http.SetCookie(w, &http.Cookie{
-		Name:     "refresh_token",
-		Value:    refreshToken,
-		HttpOnly: true,
-		Path:     "/",
-		MaxAge:   7 * 24 * 60 * 60, // 7 дней
-		Secure:   true,
-		SameSite: http.SameSiteLaxMode,
-	})
+	setRefreshCookie(w, refreshToken)
 
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte(accessToken))
@@ -114,6 +170,145 @@ func (h *Handler) ValidateToken(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
+func (h *Handler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		http.Error(w, "token must be provided", http.StatusBadRequest)
+		return
+	}
+
+	err := h.svc.VerifyEmail(token, h.clientInfo(r))
+	if err == ErrInvalidVerificationToken {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("email verified"))
+}
+
+func (h *Handler) ResendVerificationEmail(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var payload struct {
+		Email string `json:"email"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil || payload.Email == "" {
+		http.Error(w, "email must be provided", http.StatusBadRequest)
+		return
+	}
+
+	client := h.clientInfo(r)
+	// лимит по адресу не раскрывает наличие аккаунта: считаются и несуществующие адреса
+	if err := h.svc.CheckRateLimit(r.Context(), EndpointVerifyResend, client.IP, payload.Email); err != nil {
+		if !writeRateLimitError(w, err) {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if err := h.svc.ResendVerificationEmail(payload.Email, client); err != nil {
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// ответ не зависит от наличия аккаунта
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (h *Handler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var payload struct {
+		Email string `json:"email"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil || payload.Email == "" {
+		http.Error(w, "email must be provided", http.StatusBadRequest)
+		return
+	}
+
+	client := h.clientInfo(r)
+	// лимит по адресу не раскрывает наличие аккаунта: считаются и несуществующие адреса
+	if err := h.svc.CheckRateLimit(r.Context(), EndpointForgotPassword, client.IP, payload.Email); err != nil {
+		if !writeRateLimitError(w, err) {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if err := h.svc.ForgotPassword(payload.Email, client); err != nil {
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// ответ не зависит от наличия аккаунта
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (h *Handler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var payload struct {
+		Token       string `json:"token"`
+		NewPassword string `json:"new_password"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, "invalid input", http.StatusBadRequest)
+		return
+	}
+
+	if payload.Token == "" || payload.NewPassword == "" {
+		http.Error(w, "token and new_password must be provided", http.StatusBadRequest)
+		return
+	}
+
+	err := h.svc.ResetPassword(payload.Token, payload.NewPassword, h.clientInfo(r))
+	if err == ErrInvalidResetToken {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	clearRefreshCookie(w)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// публичные ключи для самостоятельной проверки токенов сервисами и клиентом
+func (h *Handler) JWKS(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	json.NewEncoder(w).Encode(CurrentKeySet().JWKS())
+}
+
 func (h *Handler) RefreshAccessToken(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
@@ -126,12 +321,23 @@ func (h *Handler) RefreshAccessToken(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	newAccessToken, err := h.svc.RefreshAccessToken(cookie.Value)
+	client := h.clientInfo(r)
+	if err := h.svc.CheckRateLimit(r.Context(), EndpointRefresh, client.IP, ""); err != nil {
+		if !writeRateLimitError(w, err) {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	newAccessToken, newRefreshToken, err := h.svc.RefreshAccessToken(cookie.Value, client)
 	if err != nil {
+		clearRefreshCookie(w)
 		http.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 
+	setRefreshCookie(w, newRefreshToken)
+
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte(newAccessToken))
 }
@@ -142,15 +348,15 @@ func (h *Handler) UpdatePassword(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token := r.Header.Get("Authorization")
-	if token == "" {
-		http.Error(w, "missing token", http.StatusUnauthorized)
+	userUuid, ok := authorize(w, r)
+	if !ok {
 		return
 	}
 
-	userUuid, err := ValidateAccessToken(strings.TrimPrefix(token, "Bearer "))
-	if err != nil {
-		http.Error(w, "invalid token", http.StatusUnauthorized)
+	if err := h.svc.CheckRateLimit(r.Context(), EndpointUpdatePassword, h.clientIP(r), userUuid); err != nil {
+		if !writeRateLimitError(w, err) {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+		}
 		return
 	}
 
@@ -169,7 +375,10 @@ func (h *Handler) UpdatePassword(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = h.svc.UpdatePassword(userUuid, payload.NewPassword, payload.OldPassword)
+	err := h.svc.UpdatePassword(userUuid, payload.NewPassword, payload.OldPassword, h.clientInfo(r))
+	if writeRateLimitError(w, err) {
+		return
+	}
 	if err == ErrInvalidPassword {
 		http.Error(w, "old_password is invalid", http.StatusBadRequest)
 		return
@@ -181,3 +390,599 @@ func (h *Handler) UpdatePassword(w http.ResponseWriter, r *http.Request) {
 
 	w.WriteHeader(http.StatusNoContent)
 }
+
+func (h *Handler) Logout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	cookie, err := r.Cookie("refresh_token")
+	if err != nil {
+		http.Error(w, "refresh token not provided", http.StatusUnauthorized)
+		return
+	}
+
+	err = h.svc.Logout(cookie.Value, h.clientInfo(r))
+	if err == ErrInvalidCreds {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	clearRefreshCookie(w)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) LogoutAll(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userUuid, ok := authorize(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.svc.LogoutAll(userUuid, h.clientInfo(r)); err != nil {
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	clearRefreshCookie(w)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// активные сессии пользователя, текущая отмечена флагом current
+func (h *Handler) Sessions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	claims, ok := authorizeClaims(w, r)
+	if !ok {
+		return
+	}
+
+	sessions, err := h.svc.ListSessions(r.Context(), claims.UserID, claims.SessionID)
+	if err != nil {
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sessions)
+}
+
+// завершение сессии на другом устройстве, путь /auth/api/v1/sessions/{id}
+func (h *Handler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	claims, ok := authorizeClaims(w, r)
+	if !ok {
+		return
+	}
+
+	sessionID := r.PathValue("id")
+	err := h.svc.RevokeSession(claims.UserID, sessionID, h.clientInfo(r))
+	if err == ErrSessionNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if sessionID == claims.SessionID {
+		clearRefreshCookie(w)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func setRefreshCookie(w http.ResponseWriter, refreshToken string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     "refresh_token",
+		Value:    refreshToken,
+		HttpOnly: true,
+		Path:     "/",
+		MaxAge:   int(refreshTokenTTL.Seconds()), // 7 дней
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// userID из Bearer access-токена; при ошибке ответ уже записан
+func authorize(w http.ResponseWriter, r *http.Request) (string, bool) {
+	claims, ok := authorizeClaims(w, r)
+	if !ok {
+		return "", false
+	}
+	return claims.UserID, true
+}
+
+// claims Bearer access-токена, когда кроме userID нужна сессия
+func authorizeClaims(w http.ResponseWriter, r *http.Request) (*Claims, bool) {
+	token := r.Header.Get("Authorization")
+	if token == "" {
+		http.Error(w, "missing token", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	claims, err := ParseAccessToken(strings.TrimPrefix(token, "Bearer "))
+	if err != nil {
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	return claims, true
+}
+
+// удаление refresh-cookie на клиенте
+func clearRefreshCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     "refresh_token",
+		Value:    "",
+		HttpOnly: true,
+		Path:     "/",
+		MaxAge:   -1,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func (h *Handler) LoginMFA(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var payload struct {
+		MFAToken string `json:"mfa_token"`
+		Code     string `json:"code"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, "invalid input", http.StatusBadRequest)
+		return
+	}
+
+	if payload.MFAToken == "" || payload.Code == "" {
+		http.Error(w, "mfa_token and code must be provided", http.StatusBadRequest)
+		return
+	}
+
+	client := h.clientInfo(r)
+	if err := h.svc.CheckRateLimit(r.Context(), EndpointLogin, client.IP, ""); err != nil {
+		if !writeRateLimitError(w, err) {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	accessToken, refreshToken, err := h.svc.LoginMFA(payload.MFAToken, payload.Code, client)
+	if writeRateLimitError(w, err) {
+		return
+	}
+	if err == ErrInvalidCreds || err == ErrInvalidMFACode {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	setRefreshCookie(w, refreshToken)
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(accessToken))
+}
+
+func (h *Handler) EnrollMFA(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userUuid, ok := authorize(w, r)
+	if !ok {
+		return
+	}
+
+	enrollment, err := h.svc.EnrollMFA(userUuid, h.clientInfo(r))
+	if err == ErrMFAAlreadyEnabled {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err == ErrGuestNotAllowed {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if err == ErrMFANotConfigured {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(enrollment)
+}
+
+func (h *Handler) ConfirmMFA(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userUuid, ok := authorize(w, r)
+	if !ok {
+		return
+	}
+
+	var payload struct {
+		Code string `json:"code"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil || payload.Code == "" {
+		http.Error(w, "code must be provided", http.StatusBadRequest)
+		return
+	}
+
+	codes, err := h.svc.ConfirmMFA(userUuid, payload.Code, h.clientInfo(r))
+	if writeRateLimitError(w, err) {
+		return
+	}
+	if err == ErrInvalidMFACode || err == ErrMFANotEnrolled {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err == ErrMFAAlreadyEnabled {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// коды показываются один раз, в БД хранятся только хэши
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string][]string{"recovery_codes": codes})
+}
+
+func (h *Handler) DisableMFA(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userUuid, ok := authorize(w, r)
+	if !ok {
+		return
+	}
+
+	var payload struct {
+		Password string `json:"password"`
+		Code     string `json:"code"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil || payload.Code == "" {
+		http.Error(w, "code must be provided", http.StatusBadRequest)
+		return
+	}
+
+	err := h.svc.DisableMFA(userUuid, payload.Password, payload.Code, h.clientInfo(r))
+	if writeRateLimitError(w, err) {
+		return
+	}
+	if err == ErrInvalidPassword {
+		http.Error(w, "password is invalid", http.StatusBadRequest)
+		return
+	}
+	if err == ErrInvalidMFACode || err == ErrMFANotEnrolled {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) Guest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	client := h.clientInfo(r)
+	if err := h.svc.CheckRateLimit(r.Context(), EndpointGuest, client.IP, ""); err != nil {
+		if !writeRateLimitError(w, err) {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	accessToken, refreshToken, err := h.svc.CreateGuest(client)
+	if err != nil {
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	setRefreshCookie(w, refreshToken)
+
+	w.WriteHeader(http.StatusCreated)
+	w.Write([]byte(accessToken))
+}
+
+func (h *Handler) UpgradeGuest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userUuid, ok := authorize(w, r)
+	if !ok {
+		return
+	}
+
+	var creds Credentials
+	if err := json.NewDecoder(r.Body).Decode(&creds); err != nil {
+		http.Error(w, "invalid input", http.StatusBadRequest)
+		return
+	}
+
+	if creds.Email == "" || creds.Password == "" {
+		http.Error(w, "email and password must be provided", http.StatusBadRequest)
+		return
+	}
+
+	err := h.svc.UpgradeGuest(userUuid, creds.Email, creds.Password, h.clientInfo(r))
+	if err == ErrInvalidEmail {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err == ErrUserExists || err == ErrNotGuest {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) DeleteAccount(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userUuid, ok := authorize(w, r)
+	if !ok {
+		return
+	}
+
+	// тот же лимит, что у смены пароля: оба эндпоинта проверяют текущий пароль
+	if err := h.svc.CheckRateLimit(r.Context(), EndpointUpdatePassword, h.clientIP(r), userUuid); err != nil {
+		if !writeRateLimitError(w, err) {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	var payload struct {
+		Password string `json:"password"`
+	}
+
+	// тело может отсутствовать у гостей
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			http.Error(w, "invalid input", http.StatusBadRequest)
+			return
+		}
+	}
+
+	err := h.svc.DeleteAccount(userUuid, payload.Password, h.clientInfo(r))
+	if writeRateLimitError(w, err) {
+		return
+	}
+	if err == ErrInvalidPassword {
+		http.Error(w, "password is invalid", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	clearRefreshCookie(w)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// управление API-ключами: GET — список, POST — создание, DELETE ?id= — отзыв.
+// Доступно только по access-токену, API-ключом нельзя выпустить новый ключ
+func (h *Handler) APIKeys(w http.ResponseWriter, r *http.Request) {
+	userUuid, ok := authorize(w, r)
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		keys, err := h.svc.ListAPIKeys(r.Context(), userUuid)
+		if err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(keys)
+
+	case http.MethodPost:
+		var req struct {
+			Name          string   `json:"name"`
+			Scopes        []string `json:"scopes"`
+			ExpiresInDays int      `json:"expires_in_days"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ExpiresInDays < 0 {
+			http.Error(w, "invalid input", http.StatusBadRequest)
+			return
+		}
+
+		key, err := h.svc.CreateAPIKey(userUuid, req.Name, req.Scopes, time.Duration(req.ExpiresInDays)*24*time.Hour, h.clientInfo(r))
+		if err == ErrInvalidAPIKeyName || err == ErrInvalidScopes {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err == ErrGuestNotAllowed || err == ErrEmailNotVerified {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		if err == ErrTooManyAPIKeys {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(key)
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *Handler) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userUuid, ok := authorize(w, r)
+	if !ok {
+		return
+	}
+
+	err := h.svc.RevokeAPIKey(userUuid, r.PathValue("id"), h.clientInfo(r))
+	if err == ErrAPIKeyNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// назначение ролей, доступно только администраторам (RequireRoles в main)
+func (h *Handler) SetRoles(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		UserID string   `json:"user_id"`
+		Roles  []string `json:"roles"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.UserID == "" {
+		http.Error(w, "invalid input", http.StatusBadRequest)
+		return
+	}
+
+	err := h.svc.SetRoles(callerFromRequest(r).UserID, req.UserID, req.Roles, h.clientInfo(r))
+	if err == ErrInvalidRoles {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err == ErrUserNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// журнал аудита для администраторов: ?user_id=&event=&from=&to=&before=&limit=,
+// from и to в RFC 3339, before — id последней записи предыдущей страницы
+func (h *Handler) Audit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	filter := AuditFilter{
+		UserID: query.Get("user_id"),
+		Event:  query.Get("event"),
+	}
+
+	if filter.UserID != "" {
+		if _, err := uuid.Parse(filter.UserID); err != nil {
+			http.Error(w, "invalid user_id", http.StatusBadRequest)
+			return
+		}
+	}
+	for name, target := range map[string]**time.Time{"from": &filter.From, "to": &filter.To} {
+		if raw := query.Get(name); raw != "" {
+			t, err := time.Parse(time.RFC3339, raw)
+			if err != nil {
+				http.Error(w, "invalid "+name, http.StatusBadRequest)
+				return
+			}
+			*target = &t
+		}
+	}
+	if raw := query.Get("before"); raw != "" {
+		before, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || before <= 0 {
+			http.Error(w, "invalid before", http.StatusBadRequest)
+			return
+		}
+		filter.BeforeID = before
+	}
+	if raw := query.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit <= 0 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		filter.Limit = limit
+	}
+
+	entries, err := h.svc.QueryAudit(r.Context(), filter)
+	if err != nil {
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
@@ -0,0 +1,62 @@
+package authgateway
+
+import (
+	"context"
+	"time"
+)
+
+// результат проверки токена для внутренних сервисов
+type Introspection struct {
+	Active     bool
+	UserID     string
+	Roles      []string
+	SessionID  string
+	ExpiresAt  time.Time // нулевое время — бессрочный API-ключ
+	Unverified bool
+	Scopes     []string
+}
+
+// в отличие от AuthMiddleWare проверяет и то, что сессия access-токена не завершена;
+// недействительный токен — не ошибка, а Active == false
+func (s *Service) Introspect(ctx context.Context, token string) (Introspection, error) {
+	if isAPIKey(token) {
+		key, err := s.AuthenticateAPIKey(ctx, token)
+		if err == ErrInvalidAPIKey {
+			return Introspection{}, nil
+		}
+		if err != nil {
+			return Introspection{}, err
+		}
+
+		info := Introspection{Active: true, UserID: key.UserID, Scopes: key.Scopes}
+		if key.ExpiresAt != nil {
+			info.ExpiresAt = *key.ExpiresAt
+		}
+		return info, nil
+	}
+
+	claims, err := ParseAccessToken(token)
+	if err != nil {
+		return Introspection{}, nil
+	}
+
+	alive, err := s.redisClient.SIsMember(ctx, sessionsKey(claims.UserID), claims.SessionID).Result()
+	if err != nil {
+		return Introspection{}, err
+	}
+	if !alive {
+		return Introspection{}, nil
+	}
+
+	info := Introspection{
+		Active:     true,
+		UserID:     claims.UserID,
+		Roles:      claims.Roles,
+		SessionID:  claims.SessionID,
+		Unverified: claims.Unverified,
+	}
+	if claims.ExpiresAt != nil {
+		info.ExpiresAt = claims.ExpiresAt.Time
+	}
+	return info, nil
+}
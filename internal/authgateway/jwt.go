@@ -1,76 +1,157 @@
 package authgateway
 
 import (
-	"os"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 )
 
-var jwtSecret = []byte(os.Getenv("JWT_SECRET")) // секрет в env или .env
+var keySet *KeySet // ключи подписи, задаются при старте через SetKeySet
+
+func SetKeySet(ks *KeySet) {
+	keySet = ks
+}
+
+func CurrentKeySet() *KeySet {
+	return keySet
+}
 
 type Claims struct {
-	UserID               string `json:"user_id"`
-	TokenType            string `json:"token_type"`
-	jwt.RegisteredClaims        // в поле RegisteredClaims кладём стандартные поля JWT-токена из библиотеки
+	UserID               string   `json:"user_id"`
+	SessionID            string   `json:"session_id"` // идентификатор сессии (устройства), к которой привязан refresh-токен
+	TokenType            string   `json:"token_type"`
+	Roles                []string `json:"roles,omitempty"`
+	Unverified           bool     `json:"unverified,omitempty"` // почта не подтверждена, доступ ограничен (LoginPolicyLimited)
+	jwt.RegisteredClaims          // в поле RegisteredClaims кладём стандартные поля JWT-токена из библиотеки
 }
 
-func GenerateAccessToken(userID string) (string, error) {
+func GenerateAccessToken(userID, sessionID string, roles []string, unverified bool) (string, error) {
 	claims := Claims{
-		UserID:    userID,
-		TokenType: "access",
+		UserID:     userID,
+		SessionID:  sessionID,
+		TokenType:  "access",
+		Roles:      roles,
+		Unverified: unverified,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(15 * time.Minute)), // срок действия на 15 минут
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtSecret)
+	return keySet.sign(claims)
 }
 
-func GenerateRefreshToken(userID string) (string, error) {
+func GenerateRefreshToken(userID, sessionID string) (string, error) {
 	claims := Claims{
 		UserID:    userID,
+		SessionID: sessionID,
 		TokenType: "refresh",
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),                                       // уникальность каждого токена при ротации
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(7 * 24 * time.Hour)), // срок действия на 7 дней
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtSecret)
+	return keySet.sign(claims)
 }
 
 func ValidateAccessToken(tokenStr string) (string, error) {
-	claims := &Claims{}
-	token, err := jwt.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
-		return jwtSecret, nil
-	})
+	claims, err := ParseAccessToken(tokenStr)
+	if err != nil {
+		return "", err
+	}
 
-	if err != nil || !token.Valid {
-		return "", ErrInvalidCreds
+	return claims.UserID, nil
+}
+
+func ParseAccessToken(tokenStr string) (*Claims, error) {
+	claims, err := parseToken(tokenStr)
+	if err != nil {
+		return nil, ErrInvalidCreds
 	}
 
 	if claims.TokenType != "access" {
-		return "", ErrInvalidCreds
+		return nil, ErrInvalidCreds
 	}
 
-	return claims.UserID, nil
+	return claims, nil
 }
 
-func ValidateRefreshToken(tokenStr string) (string, error) {
-	claims := &Claims{}
-	token, err := jwt.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
-		return jwtSecret, nil
-	})
+// возвращает userID и sessionID из refresh-токена
+func ValidateRefreshToken(tokenStr string) (string, string, error) {
+	claims, err := parseToken(tokenStr)
+	if err != nil {
+		return "", "", ErrInvalidCreds
+	}
 
-	if err != nil || !token.Valid {
+	if claims.TokenType != "refresh" || claims.SessionID == "" {
+		return "", "", ErrInvalidCreds
+	}
+
+	return claims.UserID, claims.SessionID, nil
+}
+
+// одноразовый токен из письма подтверждения почты, jti хранится в Redis до использования
+func GenerateEmailVerificationToken(userID, tokenID string) (string, error) {
+	claims := Claims{
+		UserID:    userID,
+		TokenType: "email_verification",
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        tokenID,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(emailVerificationTTL)),
+		},
+	}
+
+	return keySet.sign(claims)
+}
+
+// возвращает userID и jti токена подтверждения почты
+func ValidateEmailVerificationToken(tokenStr string) (string, string, error) {
+	claims, err := parseToken(tokenStr)
+	if err != nil {
+		return "", "", ErrInvalidVerificationToken
+	}
+
+	if claims.TokenType != "email_verification" || claims.ID == "" {
+		return "", "", ErrInvalidVerificationToken
+	}
+
+	return claims.UserID, claims.ID, nil
+}
+
+// короткоживущий токен между проверкой пароля и кода 2FA, не даёт доступа к API
+func GenerateMFAPendingToken(userID string) (string, error) {
+	claims := Claims{
+		UserID:    userID,
+		TokenType: "mfa_pending",
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(mfaPendingTTL)),
+		},
+	}
+
+	return keySet.sign(claims)
+}
+
+func ValidateMFAPendingToken(tokenStr string) (string, error) {
+	claims, err := parseToken(tokenStr)
+	if err != nil {
 		return "", ErrInvalidCreds
 	}
 
-	if claims.TokenType != "refresh" {
+	if claims.TokenType != "mfa_pending" {
 		return "", ErrInvalidCreds
 	}
 
 	return claims.UserID, nil
 }
+
+func parseToken(tokenStr string) (*Claims, error) {
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenStr, claims, keySet.keyFunc,
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()}),
+	)
+	if err != nil || !token.Valid {
+		return nil, ErrInvalidCreds
+	}
+	return claims, nil
+}
@@ -0,0 +1,185 @@
+package authgateway
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var ErrUnknownKeyID = errors.New("unknown signing key id")
+
+// ключ подписи JWT, kid попадает в заголовок токена
+type SigningKey struct {
+	ID         string
+	PrivateKey crypto.Signer
+}
+
+func (k SigningKey) method() jwt.SigningMethod {
+	if _, ok := k.PrivateKey.(ed25519.PrivateKey); ok {
+		return jwt.SigningMethodEdDSA
+	}
+	return jwt.SigningMethodRS256
+}
+
+// набор ключей: активный подписывает новые токены, остальные только проверяют ранее выданные.
+// Это позволяет ротировать ключи, не разлогинивая пользователей.
+type KeySet struct {
+	activeID string
+	keys     map[string]SigningKey
+	order    []string
+}
+
+func NewKeySet(activeID string, keys ...SigningKey) (*KeySet, error) {
+	ks := &KeySet{activeID: activeID, keys: make(map[string]SigningKey)}
+	for _, k := range keys {
+		if _, exists := ks.keys[k.ID]; exists {
+			return nil, fmt.Errorf("duplicate signing key id %q", k.ID)
+		}
+		ks.keys[k.ID] = k
+		ks.order = append(ks.order, k.ID)
+	}
+	if _, ok := ks.keys[activeID]; !ok {
+		return nil, fmt.Errorf("active signing key %q not found", activeID)
+	}
+	return ks, nil
+}
+
+// JWT_KEYS="kid1=/path/key1.pem,kid2=/path/key2.pem" — PEM-файлы приватных ключей RSA или Ed25519,
+// JWT_ACTIVE_KID — ключ для подписи (по умолчанию первый из списка)
+func LoadKeySetFromEnv() (*KeySet, error) {
+	raw := os.Getenv("JWT_KEYS")
+	if raw == "" {
+		// для локальной разработки: токены не переживут перезапуск gateway
+		log.Println("JWT_KEYS is not set, using ephemeral Ed25519 signing key")
+		_, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		return NewKeySet("ephemeral", SigningKey{ID: "ephemeral", PrivateKey: priv})
+	}
+
+	var keys []SigningKey
+	for _, entry := range strings.Split(raw, ",") {
+		kid, path, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok || kid == "" || path == "" {
+			return nil, fmt.Errorf("invalid JWT_KEYS entry %q", entry)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		priv, err := parsePrivateKey(data)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", kid, err)
+		}
+		keys = append(keys, SigningKey{ID: kid, PrivateKey: priv})
+	}
+
+	activeID := os.Getenv("JWT_ACTIVE_KID")
+	if activeID == "" {
+		activeID = keys[0].ID
+	}
+	return NewKeySet(activeID, keys...)
+}
+
+func parsePrivateKey(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		switch k := key.(type) {
+		case *rsa.PrivateKey:
+			return k, nil
+		case ed25519.PrivateKey:
+			return k, nil
+		}
+		return nil, fmt.Errorf("unsupported key type %T", key)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+}
+
+func (ks *KeySet) sign(claims jwt.Claims) (string, error) {
+	key := ks.keys[ks.activeID]
+	token := jwt.NewWithClaims(key.method(), claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.PrivateKey)
+}
+
+// выбор публичного ключа по kid из заголовка токена
+func (ks *KeySet) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := ks.keys[kid]
+	if !ok {
+		return nil, ErrUnknownKeyID
+	}
+	if token.Method.Alg() != key.method().Alg() {
+		return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+	}
+	return key.PrivateKey.Public(), nil
+}
+
+// JSON Web Key (RFC 7517), только публичная часть
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+func (ks *KeySet) JWKS() JWKS {
+	set := JWKS{Keys: make([]JWK, 0, len(ks.order))}
+	for _, kid := range ks.order {
+		key := ks.keys[kid]
+		switch pub := key.PrivateKey.Public().(type) {
+		case *rsa.PublicKey:
+			set.Keys = append(set.Keys, JWK{
+				Kty: "RSA",
+				Kid: kid,
+				Use: "sig",
+				Alg: jwt.SigningMethodRS256.Alg(),
+				N:   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			set.Keys = append(set.Keys, JWK{
+				Kty: "OKP",
+				Kid: kid,
+				Use: "sig",
+				Alg: jwt.SigningMethodEdDSA.Alg(),
+				Crv: "Ed25519",
+				X:   base64.RawURLEncoding.EncodeToString(pub),
+			})
+		}
+	}
+	return set
+}
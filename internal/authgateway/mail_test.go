@@ -0,0 +1,138 @@
+package authgateway
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/quizverse3D/Backend/internal/common"
+	"github.com/quizverse3D/Backend/internal/testutil"
+)
+
+func setTestKeySet(t *testing.T) {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ks, err := NewKeySet("test", SigningKey{ID: "test", PrivateKey: priv})
+	if err != nil {
+		t.Fatal(err)
+	}
+	prev := CurrentKeySet()
+	SetKeySet(ks)
+	t.Cleanup(func() { SetKeySet(prev) })
+}
+
+// токен из ссылки вида <prefix>?token=... в теле письма
+func tokenFromMail(t *testing.T, body, prefix string) string {
+	t.Helper()
+	for _, line := range strings.Split(body, "\n") {
+		if !strings.HasPrefix(line, prefix+"?") {
+			continue
+		}
+		link, err := url.Parse(line)
+		if err != nil {
+			t.Fatalf("parse link %q: %v", line, err)
+		}
+		return link.Query().Get("token")
+	}
+	t.Fatalf("no %s link in mail body %q", prefix, body)
+	return ""
+}
+
+func TestMailFlows(t *testing.T) {
+	cfg := Config{
+		VerifyEmailURL:   "https://quizverse.test/verify-email",
+		ResetPasswordURL: "https://quizverse.test/reset-password",
+	}
+
+	tests := []struct {
+		name    string
+		send    func(ctx context.Context, s *Service) error
+		link    string
+		subject string
+		// ключ Redis, под которым должен лежать userID для токена из письма
+		redisKey func(t *testing.T, token string) string
+		ttl      time.Duration
+	}{
+		{
+			name: "email verification",
+			send: func(ctx context.Context, s *Service) error {
+				return s.sendVerificationEmail(ctx, "u1", "user@example.com")
+			},
+			link:    cfg.VerifyEmailURL,
+			subject: "подтверждение почты",
+			redisKey: func(t *testing.T, token string) string {
+				userID, tokenID, err := ValidateEmailVerificationToken(token)
+				if err != nil {
+					t.Fatalf("ValidateEmailVerificationToken: %v", err)
+				}
+				if userID != "u1" {
+					t.Errorf("token user = %q, want u1", userID)
+				}
+				return emailVerifyKey(tokenID)
+			},
+			ttl: emailVerificationTTL,
+		},
+		{
+			name: "password reset",
+			send: func(ctx context.Context, s *Service) error {
+				return s.sendPasswordResetEmail(ctx, Auth{ID: "u1", Email: "user@example.com"})
+			},
+			link:    cfg.ResetPasswordURL,
+			subject: "сброс пароля",
+			redisKey: func(t *testing.T, token string) string {
+				return passwordResetKey(token)
+			},
+			ttl: passwordResetTTL,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setTestKeySet(t)
+			mr, rc := testutil.NewRedis(t)
+			mailer := common.NewMemoryMailer()
+			s := &Service{redisClient: rc, mailer: mailer, cfg: cfg}
+
+			if err := tt.send(context.Background(), s); err != nil {
+				t.Fatalf("send: %v", err)
+			}
+
+			messages := mailer.Messages()
+			if len(messages) != 1 {
+				t.Fatalf("sent %d messages, want 1", len(messages))
+			}
+			msg := messages[0]
+			if msg.To != "user@example.com" {
+				t.Errorf("to = %q, want user@example.com", msg.To)
+			}
+			if !strings.Contains(msg.Subject, tt.subject) {
+				t.Errorf("subject = %q, want it to contain %q", msg.Subject, tt.subject)
+			}
+
+			token := tokenFromMail(t, msg.Body, tt.link)
+			if token == "" {
+				t.Fatal("empty token in link")
+			}
+			key := tt.redisKey(t, token)
+			if got, err := mr.Get(key); err != nil || got != "u1" {
+				t.Errorf("redis %s = %q (%v), want u1", key, got, err)
+			}
+			if ttl := mr.TTL(key); ttl != tt.ttl {
+				t.Errorf("redis %s ttl = %v, want %v", key, ttl, tt.ttl)
+			}
+			// сам токен в Redis не хранится
+			for _, k := range mr.Keys() {
+				if strings.Contains(k, token) {
+					t.Errorf("token stored in redis key %q", k)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package authgateway
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP-запросы к gateway по маршруту и статусу ответа",
+	}, []string{"method", "route", "code"})
+	httpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "Время обработки HTTP-запроса",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	// регистрации, входы, гости и т.д.: event — событие журнала аудита, outcome — его результат
+	authEvents = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "authgateway_auth_events_total",
+		Help: "События аутентификации по результату",
+	}, []string{"event", "outcome"})
+)
+
+type routeLabelKey struct{}
+
+// шаблон REST → gRPC маршрута вместо пути с id, чтобы метки не размножались
+func setRouteLabel(r *http.Request, route string) {
+	if label, ok := r.Context().Value(routeLabelKey{}).(*string); ok {
+		*label = route
+	}
+}
+
+// счётчик и гистограмма запросов; маршрут — шаблон из ServeMux или из таблицы ProxyHandler
+func MetricsMiddleWare(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var route string
+		req := r.WithContext(context.WithValue(r.Context(), routeLabelKey{}, &route))
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		start := time.Now()
+		next.ServeHTTP(rec, req)
+
+		if route == "" {
+			route = req.Pattern // заполняется ServeMux
+		}
+		if route == "" {
+			route = "unmatched"
+		}
+		httpRequests.WithLabelValues(r.Method, route, strconv.Itoa(rec.status)).Inc()
+		httpRequestDuration.WithLabelValues(r.Method, route).Observe(time.Since(start).Seconds())
+	})
+}
@@ -0,0 +1,367 @@
+package authgateway
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/quizverse3D/Backend/internal/common"
+)
+
+// параметры TOTP (RFC 6238), совместимые с Google Authenticator и аналогами
+const (
+	totpPeriod        = 30 * time.Second
+	totpDigits        = 6
+	totpSkew          = 1 // допускаем соседние интервалы из-за расхождения часов
+	totpIssuer        = "Quizverse3D"
+	recoveryCodeCount = 10
+	mfaPendingTTL     = 5 * time.Minute
+	endpointLoginMFA  = "login-mfa"
+)
+
+var base32NoPadding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// вход требует второй фактор: клиент должен передать Token и код в LoginMFA
+type MFARequiredError struct {
+	Token string
+}
+
+func (e *MFARequiredError) Error() string {
+	return "mfa code required"
+}
+
+type MFAEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"`
+}
+
+func generateTOTPSecret() (string, error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base32NoPadding.EncodeToString(b), nil
+}
+
+func totpCode(secret string, counter uint64) (string, error) {
+	key, err := base32NoPadding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", err
+	}
+
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], counter)
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	// dynamic truncation (RFC 4226, 5.3)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000), nil
+}
+
+// номер интервала, в котором код совпал, или false
+func validateTOTP(secret, code string, now time.Time) (uint64, bool) {
+	if len(code) != totpDigits {
+		return 0, false
+	}
+
+	current := uint64(now.Unix()) / uint64(totpPeriod.Seconds())
+	for delta := -totpSkew; delta <= totpSkew; delta++ {
+		counter := current + uint64(delta)
+		expected, err := totpCode(secret, counter)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return counter, true
+		}
+	}
+	return 0, false
+}
+
+// AES-256-GCM, в БД хранится base64(nonce|ciphertext)
+func (s *Service) encryptMFASecret(secret string) (string, error) {
+	gcm, err := s.mfaCipher()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(secret), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (s *Service) decryptMFASecret(encrypted string) (string, error) {
+	gcm, err := s.mfaCipher()
+	if err != nil {
+		return "", err
+	}
+	data, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil {
+		return "", err
+	}
+	if len(data) < gcm.NonceSize() {
+		return "", errors.New("malformed mfa secret")
+	}
+	plain, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
+
+func (s *Service) mfaCipher() (cipher.AEAD, error) {
+	if len(s.cfg.MFAEncryptionKey) == 0 {
+		return nil, ErrMFANotConfigured
+	}
+	block, err := aes.NewCipher(s.cfg.MFAEncryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// коды восстановления сравниваются без учёта регистра и дефисов
+func hashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
+
+func generateRecoveryCodes() ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, 7)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		raw := strings.ToLower(base32NoPadding.EncodeToString(b))[:10]
+		codes[i] = raw[:5] + "-" + raw[5:]
+	}
+	return codes, nil
+}
+
+// новый (неподтверждённый) секрет; 2FA включается только после ConfirmMFA
+func (s *Service) EnrollMFA(userID string, client ClientInfo) (enrollment MFAEnrollment, err error) {
+	defer func() { s.audit(AuditEntry{Event: AuditMFAEnroll, UserID: userID}, client, err) }()
+
+	ctx := client.context()
+	mfa, ok, err := s.storage.GetMFA(ctx, userID)
+	if err != nil {
+		return MFAEnrollment{}, err
+	}
+	if ok && mfa.Enabled {
+		return MFAEnrollment{}, ErrMFAAlreadyEnabled
+	}
+
+	u, err := s.storage.GetCredInfoByUuid(ctx, userID)
+	if err != nil {
+		return MFAEnrollment{}, err
+	}
+	if u.Guest {
+		return MFAEnrollment{}, ErrGuestNotAllowed
+	}
+
+	secret, err := generateTOTPSecret()
+	if err != nil {
+		return MFAEnrollment{}, err
+	}
+	encrypted, err := s.encryptMFASecret(secret)
+	if err != nil {
+		return MFAEnrollment{}, err
+	}
+	if err := s.storage.SaveMFASecret(ctx, userID, encrypted); err != nil {
+		return MFAEnrollment{}, err
+	}
+
+	label := url.PathEscape(totpIssuer + ":" + u.Email)
+	query := url.Values{
+		"secret":    {secret},
+		"issuer":    {totpIssuer},
+		"algorithm": {"SHA1"},
+		"digits":    {fmt.Sprint(totpDigits)},
+		"period":    {fmt.Sprint(int(totpPeriod.Seconds()))},
+	}
+	return MFAEnrollment{Secret: secret, URI: "otpauth://totp/" + label + "?" + query.Encode()}, nil
+}
+
+// включение 2FA по первому коду из приложения, возвращает одноразовые коды восстановления
+func (s *Service) ConfirmMFA(userID, code string, client ClientInfo) (codes []string, err error) {
+	defer func() { s.audit(AuditEntry{Event: AuditMFAEnable, UserID: userID}, client, err) }()
+
+	ctx := client.context()
+	mfa, ok, err := s.storage.GetMFA(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrMFANotEnrolled
+	}
+	if mfa.Enabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	err = s.withMFALockout(ctx, userID, func(ctx context.Context) error {
+		return s.checkTOTP(ctx, userID, mfa.Secret, code)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	codes, err = generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	hashes := make([]string, len(codes))
+	for i, c := range codes {
+		hashes[i] = hashRecoveryCode(c)
+	}
+
+	if err := s.storage.EnableMFA(ctx, userID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// отключение 2FA требует текущий пароль и действующий код или код восстановления:
+// одного украденного access-токена недостаточно
+func (s *Service) DisableMFA(userID, password, code string, client ClientInfo) (err error) {
+	defer func() { s.audit(AuditEntry{Event: AuditMFADisable, UserID: userID}, client, err) }()
+
+	ctx := client.context()
+	mfa, ok, err := s.storage.GetMFA(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !ok || !mfa.Enabled {
+		return ErrMFANotEnrolled
+	}
+
+	u, err := s.storage.GetCredInfoByUuid(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if err := s.verifyCurrentPassword(ctx, u, password); err != nil {
+		return err
+	}
+
+	err = s.withMFALockout(ctx, userID, func(ctx context.Context) error {
+		return s.verifySecondFactor(ctx, userID, mfa.Secret, code)
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.storage.DeleteMFA(ctx, userID)
+}
+
+// второй шаг входа: mfa_pending токен из Login + код из приложения или код восстановления
+func (s *Service) LoginMFA(mfaToken, code string, client ClientInfo) (accessToken, refreshToken string, err error) {
+	userID, err := ValidateMFAPendingToken(mfaToken)
+	if err != nil {
+		return "", "", err
+	}
+	defer func() { s.audit(AuditEntry{Event: AuditLoginMFA, UserID: userID}, client, err) }()
+
+	ctx := client.context()
+	mfa, ok, err := s.storage.GetMFA(ctx, userID)
+	if err != nil {
+		return "", "", err
+	}
+	if !ok || !mfa.Enabled {
+		return "", "", ErrInvalidCreds
+	}
+
+	err = s.withMFALockout(ctx, userID, func(ctx context.Context) error {
+		return s.verifySecondFactor(ctx, userID, mfa.Secret, code)
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	u, err := s.storage.GetCredInfoByUuid(ctx, userID)
+	if err != nil {
+		return "", "", err
+	}
+	return s.createSession(ctx, u, client)
+}
+
+// проверка кода с блокировкой после серии ошибок; счётчик общий для входа, включения и отключения 2FA,
+// иначе шестизначный код можно перебирать через /mfa/confirm и /mfa/disable
+func (s *Service) withMFALockout(ctx context.Context, userID string, check func(context.Context) error) error {
+	subject := "user:" + userID
+	if err := s.limiter.CheckLockout(ctx, endpointLoginMFA, subject); err != nil {
+		return err
+	}
+
+	if err := check(ctx); err != nil {
+		if err == ErrInvalidMFACode {
+			if err := s.limiter.RegisterFailure(ctx, endpointLoginMFA, subject); err != nil {
+				common.Logf(ctx, "failed to register mfa failure for %s: %v", userID, err)
+			}
+		}
+		return err
+	}
+
+	if err := s.limiter.Reset(ctx, endpointLoginMFA, subject); err != nil {
+		common.Logf(ctx, "failed to reset mfa failures for %s: %v", userID, err)
+	}
+	return nil
+}
+
+func (s *Service) verifySecondFactor(ctx context.Context, userID, encryptedSecret, code string) error {
+	code = strings.TrimSpace(code)
+	if len(code) == totpDigits {
+		return s.checkTOTP(ctx, userID, encryptedSecret, code)
+	}
+
+	used, err := s.storage.UseRecoveryCode(ctx, userID, hashRecoveryCode(code))
+	if err != nil {
+		return err
+	}
+	if !used {
+		return ErrInvalidMFACode
+	}
+	return nil
+}
+
+func (s *Service) checkTOTP(ctx context.Context, userID, encryptedSecret, code string) error {
+	secret, err := s.decryptMFASecret(encryptedSecret)
+	if err != nil {
+		return err
+	}
+
+	counter, ok := validateTOTP(secret, code, time.Now())
+	if !ok {
+		return ErrInvalidMFACode
+	}
+
+	// один и тот же код нельзя использовать дважды (перехват и повтор)
+	key := fmt.Sprintf("mfa_used:%s:%d", userID, counter)
+	fresh, err := s.redisClient.SetNX(ctx, key, 1, totpPeriod*(2*totpSkew+1)).Result()
+	if err != nil {
+		return err
+	}
+	if !fresh {
+		return ErrInvalidMFACode
+	}
+	return nil
+}
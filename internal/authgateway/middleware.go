@@ -4,23 +4,163 @@ import (
 	"context"
 	"net/http"
 	"strings"
+	"time"
+
+	"github.com/quizverse3D/Backend/internal/common"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
-func AuthMiddleWare(next http.Handler) http.Handler {
+// статус ответа для access-лога
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusRecorder) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// X-Request-ID клиента (или новый) кладётся в контекст и возвращается в ответе;
+// дальше он уходит в gRPC metadata и заголовки событий RabbitMQ
+func RequestIDMiddleWare(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		token := r.Header.Get("Authorization")
-		if token == "" {
-			http.Error(w, "missing token", http.StatusUnauthorized)
-			return
+		requestID := r.Header.Get(common.RequestIDHeader)
+		if !common.IsValidRequestID(requestID) {
+			requestID = common.NewRequestID()
 		}
+		w.Header().Set(common.RequestIDHeader, requestID)
+		trace.SpanFromContext(r.Context()).SetAttributes(attribute.String("request.id", requestID))
+
+		ctx := common.ContextWithRequestID(r.Context(), requestID)
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		start := time.Now()
+		next.ServeHTTP(rec, r.WithContext(ctx))
+		common.Logf(ctx, "%s %s %d %s", r.Method, r.URL.Path, rec.status, time.Since(start))
+	})
+}
+
+// итог проверки заголовка Authorization; status != 0 — запрос отклоняется с этой ошибкой
+type authResult struct {
+	userID string
+	roles  []string
+	scopes []string // только у API-ключа
+	apiKey bool
+
+	status int
+	code   string
+	detail string
+}
 
-		userId, err := ValidateAccessToken(strings.TrimPrefix(token, "Bearer "))
+// результат authenticate, уже полученный RateLimitMiddleWare
+type authResultKey struct{}
+
+// принимает access-токен или API-ключ; у ключа нет ролей, его права ограничены scopes
+func (h *Handler) authenticate(r *http.Request) authResult {
+	token := r.Header.Get("Authorization")
+	if token == "" {
+		return authResult{status: http.StatusUnauthorized, code: "UNAUTHENTICATED", detail: "missing token"}
+	}
+	token = strings.TrimPrefix(token, "Bearer ")
+
+	if isAPIKey(token) {
+		key, err := h.svc.AuthenticateAPIKey(r.Context(), token)
+		if err == ErrInvalidAPIKey {
+			return authResult{status: http.StatusUnauthorized, code: "INVALID_API_KEY", detail: "invalid api key"}
+		}
 		if err != nil {
-			http.Error(w, "invalid token", http.StatusUnauthorized)
+			return authResult{status: http.StatusInternalServerError, code: "INTERNAL", detail: http.StatusText(http.StatusInternalServerError)}
+		}
+		return authResult{userID: key.UserID, scopes: key.Scopes, apiKey: true}
+	}
+
+	claims, err := ParseAccessToken(token)
+	if err != nil {
+		return authResult{status: http.StatusUnauthorized, code: "INVALID_TOKEN", detail: "invalid token"}
+	}
+	if claims.Unverified {
+		return authResult{status: http.StatusForbidden, code: "EMAIL_NOT_VERIFIED", detail: "email is not verified"}
+	}
+	return authResult{userID: claims.UserID, roles: claims.Roles}
+}
+
+// пропускает только запросы с действительным токеном; ошибки — в application/problem+json, как и ответы ProxyHandler
+func (h *Handler) AuthMiddleWare(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth, ok := r.Context().Value(authResultKey{}).(authResult)
+		if !ok {
+			auth = h.authenticate(r)
+		}
+		if auth.status != 0 {
+			writeProblem(w, r, auth.status, auth.code, auth.detail)
 			return
 		}
 
-		ctx := context.WithValue(r.Context(), "userId", userId)
+		ctx := context.WithValue(r.Context(), "userId", auth.userID)
+		if auth.apiKey {
+			ctx = context.WithValue(ctx, "apiKeyScopes", auth.scopes)
+		} else {
+			ctx = context.WithValue(ctx, "userRoles", auth.roles)
+		}
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
+
+// квоты REST → gRPC маршрутов (token bucket в Redis). Стоит перед AuthMiddleWare, чтобы запросы
+// без действительного токена тоже расходовали квоту — по IP клиента, остальные — по userId.
+// Токен проверяется здесь один раз, AuthMiddleWare берёт результат из контекста.
+// Неизвестные пути пропускаются, на них ответит ProxyHandler
+func (h *Handler) RateLimitMiddleWare(grpcServiceRoute GRPCServiceRoute, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route, _, _ := grpcServiceRoute.lookup(r.Method, r.URL.Path)
+		if route == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		auth := h.authenticate(r)
+		r = r.WithContext(context.WithValue(r.Context(), authResultKey{}, auth))
+		subject := "ip:" + h.clientIP(r)
+		if auth.status == 0 {
+			subject = "user:" + auth.userID
+		}
+
+		limit, state, err := h.svc.TakeRouteToken(r.Context(), route, subject)
+		if err != nil {
+			// недоступность Redis не должна останавливать API
+			common.Logf(r.Context(), "rate limit check failed for %s %s: %v", r.Method, r.URL.Path, err)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		writeRateLimitHeaders(w, limit, state)
+		if !state.Allowed {
+			writeProblem(w, r, http.StatusTooManyRequests, "RATE_LIMITED", "route quota exceeded")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// цепочка маршрутов gRPC-сервиса: квота, аутентификация, проксирование
+func (h *Handler) ServiceRouteHandler(grpcServiceRoute GRPCServiceRoute) http.Handler {
+	return h.RateLimitMiddleWare(grpcServiceRoute, h.AuthMiddleWare(ProxyHandler(grpcServiceRoute)))
+}
+
+// доступ только пользователям с одной из ролей; ставится после AuthMiddleWare
+func RequireRoles(next http.Handler, roles ...string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !callerFromRequest(r).HasRole(roles...) {
+			writeProblem(w, r, http.StatusForbidden, "PERMISSION_DENIED", "insufficient role")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func callerFromRequest(r *http.Request) common.Caller {
+	userId, _ := r.Context().Value("userId").(string)
+	roles, _ := r.Context().Value("userRoles").([]string)
+	return common.Caller{UserID: userId, Roles: roles}
+}
@@ -0,0 +1,140 @@
+package authgateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/quizverse3D/Backend/internal/common"
+	roomPb "github.com/quizverse3D/Backend/internal/pb/room"
+	"github.com/quizverse3D/Backend/internal/testutil"
+)
+
+// отказы AuthMiddleWare и RequireRoles приходят в application/problem+json
+func TestAuthMiddleWareProblems(t *testing.T) {
+	setTestKeySet(t)
+	unverified, err := GenerateAccessToken("u1", "s1", nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := GenerateAccessToken("u1", "s1", []string{common.RoleUser}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	refresh, err := GenerateRefreshToken("u1", "s1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := &Handler{svc: &Service{}}
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) })
+	admin := h.AuthMiddleWare(RequireRoles(ok, common.RoleAdmin))
+
+	tests := []struct {
+		name          string
+		authorization string
+		wantStatus    int
+		wantCode      string
+	}{
+		{"missing token", "", http.StatusUnauthorized, "UNAUTHENTICATED"},
+		{"garbage token", "Bearer garbage", http.StatusUnauthorized, "INVALID_TOKEN"},
+		{"refresh token", "Bearer " + refresh, http.StatusUnauthorized, "INVALID_TOKEN"},
+		{"unverified email", "Bearer " + unverified, http.StatusForbidden, "EMAIL_NOT_VERIFIED"},
+		{"missing role", "Bearer " + user, http.StatusForbidden, "PERMISSION_DENIED"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/auth/api/v1/admin/audit", nil)
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+			w := httptest.NewRecorder()
+			admin.ServeHTTP(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (%s)", w.Code, tt.wantStatus, w.Body)
+			}
+			if ct := w.Header().Get("Content-Type"); ct != "application/problem+json" {
+				t.Errorf("content type = %q, want application/problem+json", ct)
+			}
+			var problem Problem
+			if err := json.NewDecoder(w.Body).Decode(&problem); err != nil {
+				t.Fatalf("decode problem: %v", err)
+			}
+			if problem.Code != tt.wantCode {
+				t.Errorf("code = %q, want %q", problem.Code, tt.wantCode)
+			}
+		})
+	}
+}
+
+// запросы без действительного токена расходуют квоту маршрута по IP, не дожидаясь отказа AuthMiddleWare
+func TestServiceRouteHandlerRateLimit(t *testing.T) {
+	setTestKeySet(t)
+	token, err := GenerateAccessToken("u1", "s1", []string{common.RoleUser}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, rc := testutil.NewRedis(t)
+	svc := &Service{
+		limiter: NewRateLimiter(rc, nil, LockoutConfig{}),
+		cfg:     Config{RouteRateLimit: Limit{Requests: 2, Window: time.Minute}},
+	}
+	// без политик все маршруты получают Config.RouteRateLimit
+	route, err := NewGrpcServiceRoute("127.0.0.1:1", "/room/api/v1/", "rooms", roomPb.RoomService_ServiceDesc.ServiceName, nil)
+	if err != nil {
+		t.Fatalf("NewGrpcServiceRoute: %v", err)
+	}
+	t.Cleanup(func() { route.Conn.Close() })
+	handler := (&Handler{svc: svc}).ServiceRouteHandler(route)
+
+	steps := []struct {
+		name          string
+		remoteAddr    string
+		authorization string
+		wantStatus    int
+		wantCode      string
+	}{
+		{"anonymous", "203.0.113.5:1234", "", http.StatusUnauthorized, "UNAUTHENTICATED"},
+		{"invalid token from the same ip", "203.0.113.5:1234", "Bearer garbage", http.StatusUnauthorized, "INVALID_TOKEN"},
+		{"ip quota exhausted", "203.0.113.5:1234", "", http.StatusTooManyRequests, "RATE_LIMITED"},
+		{"invalid token after quota", "203.0.113.5:1234", "Bearer garbage", http.StatusTooManyRequests, "RATE_LIMITED"},
+		{"anonymous from another ip", "203.0.113.6:1234", "", http.StatusUnauthorized, "UNAUTHENTICATED"},
+		{"user from the exhausted ip", "203.0.113.5:1234", "Bearer " + token, 0, ""},
+	}
+
+	for _, step := range steps {
+		r := httptest.NewRequest(http.MethodGet, "/room/api/v1/rooms", nil)
+		r.RemoteAddr = step.remoteAddr
+		if step.authorization != "" {
+			r.Header.Set("Authorization", step.authorization)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		if w.Header().Get("RateLimit-Limit") != "2" {
+			t.Errorf("%s: RateLimit-Limit = %q, want 2", step.name, w.Header().Get("RateLimit-Limit"))
+		}
+		// пользователь проходит квоту и AuthMiddleWare; gRPC-сервиса нет, поэтому статус не проверяется
+		if step.wantStatus == 0 {
+			if w.Code == http.StatusTooManyRequests || w.Code == http.StatusUnauthorized {
+				t.Errorf("%s: status = %d, want the request to reach the proxy", step.name, w.Code)
+			}
+			continue
+		}
+		if w.Code != step.wantStatus {
+			t.Fatalf("%s: status = %d, want %d (%s)", step.name, w.Code, step.wantStatus, w.Body)
+		}
+		var problem Problem
+		if err := json.NewDecoder(w.Body).Decode(&problem); err != nil {
+			t.Fatalf("%s: decode problem: %v", step.name, err)
+		}
+		if problem.Code != step.wantCode {
+			t.Errorf("%s: code = %q, want %q", step.name, problem.Code, step.wantCode)
+		}
+	}
+}
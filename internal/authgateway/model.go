@@ -1,8 +1,32 @@
 package authgateway
 
+import "time"
+
 type Auth struct {
 	ID           string
 	Email        string
 	Password     string
-	PasswordSalt string
+	PasswordSalt string // только у старых bcrypt-хешей
+	Verified     bool
+	Guest        bool // анонимный аккаунт без email и пароля
+	Roles        []string
+}
+
+type MFA struct {
+	UserID  string
+	Secret  string // зашифрованный TOTP-секрет
+	Enabled bool
+}
+
+// персональный API-ключ; сам ключ показывается один раз при создании, хранится только хеш
+type APIKey struct {
+	ID         string     `json:"id"`
+	UserID     string     `json:"-"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"` // начало ключа, чтобы пользователь мог его узнать
+	KeyHash    string     `json:"-"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
 }
@@ -0,0 +1,245 @@
+package authgateway
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/quizverse3D/Backend/internal/common"
+	"github.com/streadway/amqp"
+)
+
+const (
+	outboxPollInterval   = time.Second
+	outboxBatchSize      = 100
+	outboxConfirmTimeout = 5 * time.Second
+	outboxLease          = time.Minute // с запасом больше, чем публикация пачки до первой ошибки
+	outboxPurgeInterval  = time.Hour
+	outboxRetention      = 24 * time.Hour // отправленные события хранятся для разбора инцидентов
+)
+
+// событие, записанное в outbox в одной транзакции с изменением данных
+type OutboxMessage struct {
+	ID         int64
+	Exchange   string
+	RoutingKey string
+	Payload    []byte
+	RequestID  string
+	// traceparent запроса: спан отправки relay становится его продолжением
+	TraceParent string
+}
+
+// событие для сервиса Users: создание профиля и кэша username
+func userRegisteredEvent(ctx context.Context, id, username string) (OutboxMessage, error) {
+	body, err := json.Marshal(map[string]string{"userId": id, "userName": username})
+	if err != nil {
+		return OutboxMessage{}, err
+	}
+	return OutboxMessage{
+		RoutingKey:  "user_registered",
+		Payload:     body,
+		RequestID:   common.RequestIDFromContext(ctx),
+		TraceParent: common.TraceParent(ctx),
+	}, nil
+}
+
+// fanout-событие для сервисов Users и Rooms: удаление профиля и комнат
+func userDeletedEvent(ctx context.Context, id string) (OutboxMessage, error) {
+	body, err := json.Marshal(map[string]string{"userId": id})
+	if err != nil {
+		return OutboxMessage{}, err
+	}
+	return OutboxMessage{
+		Exchange:    "user_deleted",
+		Payload:     body,
+		RequestID:   common.RequestIDFromContext(ctx),
+		TraceParent: common.TraceParent(ctx),
+	}, nil
+}
+
+func insertOutbox(ctx context.Context, tx pgx.Tx, m OutboxMessage) error {
+	_, err := tx.Exec(ctx,
+		"INSERT INTO outbox (exchange, routing_key, payload, request_id, traceparent) VALUES ($1, $2, $3, NULLIF($4, ''), NULLIF($5, ''))",
+		m.Exchange, m.RoutingKey, m.Payload, m.RequestID, m.TraceParent,
+	)
+	return err
+}
+
+// переносит события из outbox в RabbitMQ с подтверждением публикации (at-least-once):
+// строка помечается отправленной только после ack брокера
+type OutboxRelay struct {
+	storage *Storage
+	conn    *amqp.Connection
+	notify  chan struct{}
+
+	// канал пересоздаётся после закрытия брокером; nil — канала сейчас нет
+	channel  *amqp.Channel
+	confirms chan amqp.Confirmation
+	closed   chan *amqp.Error
+	nextTag  uint64
+}
+
+func NewOutboxRelay(storage *Storage, conn *amqp.Connection) (*OutboxRelay, error) {
+	r := &OutboxRelay{
+		storage: storage,
+		conn:    conn,
+		notify:  make(chan struct{}, 1),
+	}
+	if err := r.openChannel(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// отдельный канал: в режиме confirm брокер подтверждает каждую публикацию в нём
+func (r *OutboxRelay) openChannel() error {
+	ch, err := r.conn.Channel()
+	if err != nil {
+		return err
+	}
+	if err := ch.Confirm(false); err != nil {
+		ch.Close()
+		return err
+	}
+
+	// очередь объявляется и здесь, чтобы события не терялись, пока сервис Users не запущен
+	if _, err := ch.QueueDeclare("user_registered", true, false, false, false, nil); err != nil {
+		ch.Close()
+		return err
+	}
+
+	r.channel = ch
+	r.confirms = ch.NotifyPublish(make(chan amqp.Confirmation, outboxBatchSize))
+	r.closed = ch.NotifyClose(make(chan *amqp.Error, 1))
+	r.nextTag = 1
+	return nil
+}
+
+// будит relay сразу после записи события, не дожидаясь очередного опроса
+func (r *OutboxRelay) Notify() {
+	if r == nil {
+		return
+	}
+	select {
+	case r.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (r *OutboxRelay) Run(ctx context.Context) {
+	ticker := time.NewTicker(outboxPollInterval)
+	defer ticker.Stop()
+	purgeTicker := time.NewTicker(outboxPurgeInterval)
+	defer purgeTicker.Stop()
+	defer func() {
+		if r.channel != nil {
+			r.channel.Close()
+		}
+	}()
+
+	for {
+		if r.channel == nil {
+			if err := r.openChannel(); err != nil {
+				log.Printf("outbox relay: failed to reopen channel: %v", err)
+			}
+		}
+		if r.channel != nil {
+			for {
+				sent, err := r.processBatch(ctx)
+				if err != nil {
+					log.Printf("outbox relay: %v", err)
+				}
+				if err != nil || sent < outboxBatchSize {
+					break
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case err := <-r.closed:
+			// канал закрывается брокером после ошибки канала или разрыва соединения
+			log.Printf("outbox relay: channel closed: %v", err)
+			r.channel, r.confirms, r.closed = nil, nil, nil
+		case <-purgeTicker.C:
+			purged, err := r.storage.PurgeOutbox(ctx, outboxRetention)
+			if err != nil {
+				log.Printf("outbox relay: failed to purge sent events: %v", err)
+			} else if purged > 0 {
+				log.Printf("outbox relay: purged %d sent events", purged)
+			}
+		case <-ticker.C:
+		case <-r.notify:
+		}
+	}
+}
+
+// публикует пачку по порядку; после первой ошибки аренда оставшихся снимается,
+// чтобы следующий опрос начал с них же
+func (r *OutboxRelay) processBatch(ctx context.Context) (int, error) {
+	messages, err := r.storage.ClaimOutbox(ctx, outboxBatchSize, outboxLease)
+	if err != nil {
+		return 0, err
+	}
+
+	for i, m := range messages {
+		err := r.publish(m)
+		if err == nil {
+			err = r.storage.MarkOutboxSent(ctx, m.ID)
+		}
+		if err != nil {
+			ids := make([]int64, 0, len(messages)-i)
+			for _, rest := range messages[i:] {
+				ids = append(ids, rest.ID)
+			}
+			if err := r.storage.ReleaseOutbox(ctx, ids); err != nil {
+				log.Printf("outbox relay: failed to release events: %v", err)
+			}
+			return i, err
+		}
+	}
+	return len(messages), nil
+}
+
+func (r *OutboxRelay) publish(m OutboxMessage) (err error) {
+	ctx := common.ContextWithRequestID(context.Background(), m.RequestID)
+	ctx, span := common.StartPublishSpan(common.ContextWithTraceParent(ctx, m.TraceParent), m.Exchange, m.RoutingKey)
+	defer func() { common.EndSpan(span, err) }()
+
+	err = r.channel.Publish(m.Exchange, m.RoutingKey, false, false, amqp.Publishing{
+		ContentType:  "application/json",
+		DeliveryMode: amqp.Persistent,
+		Headers:      common.AMQPHeaders(ctx),
+		Body:         m.Payload,
+	})
+	if err != nil {
+		return err
+	}
+	tag := r.nextTag
+	r.nextTag++
+
+	timeout := time.After(outboxConfirmTimeout)
+	for {
+		select {
+		case confirm, ok := <-r.confirms:
+			if !ok {
+				return errors.New("confirm channel closed")
+			}
+			// запоздавшие подтверждения предыдущих публикаций, по которым истёк таймаут
+			if confirm.DeliveryTag < tag {
+				continue
+			}
+			if !confirm.Ack {
+				return fmt.Errorf("outbox message %d nacked by broker", m.ID)
+			}
+			return nil
+		case <-timeout:
+			return fmt.Errorf("outbox message %d: confirm timeout", m.ID)
+		}
+	}
+}
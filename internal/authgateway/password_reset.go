@@ -0,0 +1,88 @@
+package authgateway
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/quizverse3D/Backend/internal/common"
+	"github.com/redis/go-redis/v9"
+)
+
+const passwordResetTTL = 30 * time.Minute
+
+// password_reset:<sha256(token)> — userID; в Redis хранится только хэш, сам токен есть лишь в письме
+func passwordResetKey(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return fmt.Sprintf("password_reset:%s", hex.EncodeToString(sum[:]))
+}
+
+// отправка письма со ссылкой сброса; для неизвестных адресов ничего не делает,
+// чтобы по ответу нельзя было определить наличие аккаунта. Письмо уходит в фоне:
+// иначе по времени ответа (SMTP) было бы видно, что аккаунт существует
+func (s *Service) ForgotPassword(email string, client ClientInfo) (err error) {
+	ctx := client.context()
+	u, ok := s.storage.GetAuth(ctx, email)
+	defer func() { s.audit(AuditEntry{Event: AuditPasswordForgot, UserID: u.ID, Email: email}, client, err) }()
+	if !ok {
+		return nil
+	}
+
+	go func() {
+		if err := s.sendPasswordResetEmail(ctx, u); err != nil {
+			common.Logf(ctx, "failed to send password reset email to %s: %v", u.Email, err)
+		}
+	}()
+	return nil
+}
+
+func (s *Service) sendPasswordResetEmail(ctx context.Context, u Auth) error {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+
+	if err := s.redisClient.Set(ctx, passwordResetKey(token), u.ID, passwordResetTTL).Err(); err != nil {
+		return err
+	}
+
+	link := s.cfg.ResetPasswordURL + "?token=" + url.QueryEscape(token)
+	return s.mailer.Send(ctx, common.MailMessage{
+		To:      u.Email,
+		Subject: "Quizverse3D: сброс пароля",
+		Body:    "Для сброса пароля перейдите по ссылке:\n" + link + "\n\nСсылка действительна 30 минут. Если вы не запрашивали сброс, просто проигнорируйте письмо.",
+	})
+}
+
+// установка нового пароля по токену из письма; все сессии пользователя завершаются, API-ключи отзываются
+func (s *Service) ResetPassword(token, newPassword string, client ClientInfo) (err error) {
+	var userID string
+	defer func() { s.audit(AuditEntry{Event: AuditPasswordReset, UserID: userID}, client, err) }()
+
+	// GETDEL делает токен одноразовым
+	ctx := client.context()
+	userID, err = s.redisClient.GetDel(ctx, passwordResetKey(token)).Result()
+	if err == redis.Nil {
+		return ErrInvalidResetToken
+	}
+	if err != nil {
+		return err
+	}
+
+	hashed, err := s.hasher.Hash(newPassword)
+	if err != nil {
+		return err
+	}
+
+	if err := s.storage.ResetPasswordForUuid(ctx, userID, hashed); err != nil {
+		return err
+	}
+
+	return s.revokeAllSessions(ctx, userID)
+}
@@ -0,0 +1,97 @@
+package authgateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"unicode"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// тело ошибки по RFC 7807 (application/problem+json); Code — стабильный машинно-читаемый код
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	Code     string `json:"code"`
+}
+
+func writeProblem(w http.ResponseWriter, r *http.Request, httpStatus int, code, detail string) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(httpStatus)
+	json.NewEncoder(w).Encode(Problem{
+		Type:     "about:blank",
+		Title:    http.StatusText(httpStatus),
+		Status:   httpStatus,
+		Detail:   detail,
+		Instance: r.URL.Path,
+		Code:     code,
+	})
+}
+
+// HTTP-статус для gRPC-кода, как в grpc-gateway
+func httpStatusFromCode(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.Canceled:
+		return 499 // клиент закрыл соединение
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// ошибка вызова gRPC-сервиса; текст 5xx-ошибок клиенту не отдаётся
+func writeGRPCError(w http.ResponseWriter, r *http.Request, err error) {
+	st := status.Convert(err)
+	httpStatus := httpStatusFromCode(st.Code())
+
+	code := codeName(st.Code())
+	for _, detail := range st.Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok && info.GetReason() != "" {
+			code = info.GetReason()
+			break
+		}
+	}
+
+	message := st.Message()
+	if httpStatus >= http.StatusInternalServerError {
+		message = http.StatusText(httpStatus)
+	}
+	writeProblem(w, r, httpStatus, code, message)
+}
+
+// NotFound → NOT_FOUND
+func codeName(code codes.Code) string {
+	var b strings.Builder
+	for i, c := range code.String() {
+		if i > 0 && unicode.IsUpper(c) {
+			b.WriteByte('_')
+		}
+		b.WriteRune(unicode.ToUpper(c))
+	}
+	return b.String()
+}
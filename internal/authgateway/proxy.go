@@ -1,183 +1,473 @@
 package authgateway
 
 import (
-	"context"
-	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"net/url"
+	"slices"
 	"strconv"
 	"strings"
 
-	roomPb "github.com/quizverse3D/Backend/internal/pb/room"
-	userPb "github.com/quizverse3D/Backend/internal/pb/user"
+	"github.com/quizverse3D/Backend/internal/common"
+	gatewayPb "github.com/quizverse3D/Backend/internal/pb/gateway"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/genproto/googleapis/api/annotations"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
 )
 
+// тело REST-запроса к сервису; больше не читается, чтобы клиент не мог занять память gateway
+const maxProxyBodySize = 1 << 20
+
+// имена полей как в proto (user_uuid), нулевые значения не пропускаются
+var (
+	marshalOptions   = protojson.MarshalOptions{UseProtoNames: true, EmitUnpopulated: true}
+	unmarshalOptions = protojson.UnmarshalOptions{DiscardUnknown: true}
+)
+
+// REST-маршрут, построенный по аннотации google.api.http gRPC-метода.
+// Запрос собирается по правилам транскодирования: тело (Body), затем параметры строки запроса
+// (если тело не "*"), затем {name}-сегменты пути; поля с опцией gateway.caller_id
+// заполняются userID аутентифицированного пользователя, если не привязаны к пути
+type Route struct {
+	Method     string
+	Path       string // шаблон пути, например "/room/api/v1/rooms/{id}"
+	GRPCMethod string // полное имя, например "/room.RoomService/CreateRoom"
+	Body       string // "*" — всё сообщение, имя поля — только это поле, пусто — тело не читается
+	RoutePolicy
+
+	segments []string
+	input    protoreflect.MessageType
+	output   protoreflect.MessageType
+	callers  []protoreflect.FieldDescriptor
+	required []protoreflect.FieldDescriptor
+}
+
 type GRPCServiceRoute struct {
 	TargetAddr string
+	Prefix     string
+	Scope      string // ресурс в правах API-ключа: <Scope>:read / <Scope>:write
 	Conn       *grpc.ClientConn
-	Call       func(ctx context.Context, grpcConn *grpc.ClientConn, userId string, body []byte) (any, error)
+	Routes     []Route
+}
+
+// правила gateway для отдельного маршрута, которые нельзя выразить в google.api.http
+type RoutePolicy struct {
+	Roles     []string // достаточно одной из ролей; пусто — доступно любому пользователю
+	Successor string   // маршрут устарел: в ответ добавляются Deprecation и Link на замену
+	RateLimit Limit    // квота на пользователя; нулевая — Config.RouteRateLimit. У маршрута с Successor берётся квота замены
 }
 
-func NewUserGrpcServiceRoute(targetAddr string, urlPrefix string) (GRPCServiceRoute, error) {
-	// сервис USER
-	conn, err := grpc.NewClient(targetAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+// маршруты строятся по описанию gRPC-сервиса при старте: методы без google.api.http не публикуются.
+// policies задаёт правила для отдельных маршрутов в виде "<METHOD> <шаблон пути>"
+func NewGrpcServiceRoute(targetAddr, urlPrefix, scope, service string, policies map[string]RoutePolicy) (GRPCServiceRoute, error) {
+	routes, err := serviceRoutes(protoreflect.FullName(service))
+	if err != nil {
+		return GRPCServiceRoute{}, fmt.Errorf("service %s: %w", service, err)
+	}
+	for i := range routes {
+		if !strings.HasPrefix(routes[i].Path, urlPrefix) {
+			return GRPCServiceRoute{}, fmt.Errorf("service %s: path %s is outside of %s", service, routes[i].Path, urlPrefix)
+		}
+		routes[i].RoutePolicy = policies[routes[i].Method+" "+routes[i].Path]
+		// у устаревшего маршрута общая корзина с заменой, поэтому и квота её
+		if routes[i].Successor != "" {
+			routes[i].RateLimit = policies[routes[i].Method+" "+routes[i].Successor].RateLimit
+		}
+	}
+
+	conn, err := grpc.NewClient(targetAddr,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithStatsHandler(otelgrpc.NewClientHandler()),
+		grpc.WithUnaryInterceptor(common.GRPCClientMetricsInterceptor()),
+	)
 	if err != nil {
 		return GRPCServiceRoute{}, err
 	}
-	route := GRPCServiceRoute{
+
+	return GRPCServiceRoute{
 		TargetAddr: targetAddr,
+		Prefix:     urlPrefix,
+		Scope:      scope,
 		Conn:       conn,
-		Call: func(ctx context.Context, conn *grpc.ClientConn, userId string, body []byte) (any, error) {
-			path := strings.TrimPrefix(ctx.Value("requestPath").(string), urlPrefix)
-			method := ctx.Value("requestMethod").(string)
-			client := userPb.NewUserServiceClient(conn)
-
-			switch path {
-			case "me":
-				switch method {
-				case http.MethodGet:
-					var req userPb.GetUserRequest
-					req.UserId = userId
-					return client.GetUser(ctx, &req)
-
-				default:
-					return nil, errors.New("unsupported method")
-				}
-
-			case "params":
-				switch method {
-				case http.MethodGet:
-					var req userPb.GetUserClientParamsRequest
-					req.UserUuid = userId
-					return client.GetUserClientParams(ctx, &req)
-				case http.MethodPost:
-					var req userPb.SetUserClientParamsRequest
-					if err := json.Unmarshal(body, &req); err != nil {
-						return nil, err
-					}
-					req.UserUuid = userId
-					return client.SetUserClientParams(ctx, &req)
-
-				default:
-					return nil, errors.New("unsupported method")
-				}
-
-			default:
-				return nil, errors.New("path not found: " + path)
+		Routes:     routes,
+	}, nil
+}
+
+func serviceRoutes(name protoreflect.FullName) ([]Route, error) {
+	desc, err := protoregistry.GlobalFiles.FindDescriptorByName(name)
+	if err != nil {
+		return nil, err
+	}
+	service, ok := desc.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a service", name)
+	}
+
+	var routes []Route
+	methods := service.Methods()
+	for i := 0; i < methods.Len(); i++ {
+		method := methods.Get(i)
+		rule, ok := proto.GetExtension(method.Options(), annotations.E_Http).(*annotations.HttpRule)
+		if !ok || rule == nil {
+			continue
+		}
+
+		// дополнительные привязки не могут иметь собственных additional_bindings
+		rules := append([]*annotations.HttpRule{rule}, rule.GetAdditionalBindings()...)
+		for _, rule := range rules {
+			route, err := newRoute(method, rule)
+			if err != nil {
+				return nil, fmt.Errorf("method %s: %w", method.Name(), err)
 			}
-		},
+			routes = append(routes, route)
+		}
 	}
-	return route, nil
+	return routes, nil
 }
 
-func NewRoomGrpcServiceRoute(targetAddr string, urlPrefix string) (GRPCServiceRoute, error) {
-	// сервис ROOM
-	conn, err := grpc.NewClient(targetAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
-	if err != nil {
-		return GRPCServiceRoute{}, err
+func newRoute(method protoreflect.MethodDescriptor, rule *annotations.HttpRule) (Route, error) {
+	route := Route{
+		GRPCMethod: fmt.Sprintf("/%s/%s", method.Parent().FullName(), method.Name()),
+		Body:       rule.GetBody(),
+	}
+	switch pattern := rule.GetPattern().(type) {
+	case *annotations.HttpRule_Get:
+		route.Method, route.Path = http.MethodGet, pattern.Get
+	case *annotations.HttpRule_Post:
+		route.Method, route.Path = http.MethodPost, pattern.Post
+	case *annotations.HttpRule_Put:
+		route.Method, route.Path = http.MethodPut, pattern.Put
+	case *annotations.HttpRule_Patch:
+		route.Method, route.Path = http.MethodPatch, pattern.Patch
+	case *annotations.HttpRule_Delete:
+		route.Method, route.Path = http.MethodDelete, pattern.Delete
+	default:
+		return Route{}, fmt.Errorf("unsupported http pattern %T", pattern)
+	}
+	if rule.GetResponseBody() != "" {
+		return Route{}, fmt.Errorf("response_body is not supported")
 	}
 
-	route := GRPCServiceRoute{
-		TargetAddr: targetAddr,
-		Conn:       conn,
-		Call: func(ctx context.Context, conn *grpc.ClientConn, userId string, body []byte) (any, error) {
-			path := strings.TrimPrefix(ctx.Value("requestPath").(string), urlPrefix)
-			method := ctx.Value("requestMethod").(string)
-			client := roomPb.NewRoomServiceClient(conn)
-
-			switch path {
-			case "room":
-				switch method {
-				case http.MethodPost:
-					var req roomPb.CreateRoomParamsRequest
-					if err := json.Unmarshal(body, &req); err != nil {
-						return nil, err
-					}
-					req.UserUuid = userId
-					return client.CreateRoom(ctx, &req)
-
-				case http.MethodGet:
-					var req roomPb.GetRoomParamsRequest
-					req.Id = ctx.Value("requestQuery").(url.Values).Get("id")
-					return client.GetRoomById(ctx, &req)
-
-				case http.MethodDelete:
-					query := ctx.Value("requestQuery").(url.Values)
-					id := query.Get("id")
-					if id == "" {
-						return nil, errors.New("id is required")
-					}
-					req := roomPb.DeleteRoomRequest{
-						Id:       id,
-						UserUuid: userId,
-					}
-					return client.DeleteRoom(ctx, &req)
-
-				default:
-					return nil, errors.New("unsupported method")
-				}
-
-			case "rooms":
-				switch method {
-				case http.MethodGet:
-					query := ctx.Value("requestQuery").(url.Values)
-					var req roomPb.SearchRoomsRequest
-					req.Query = query.Get("query")
-					if page := query.Get("page"); page != "" {
-						pageVal, err := strconv.ParseUint(page, 10, 32)
-						if err != nil {
-							return nil, err
-						}
-						req.Page = uint32(pageVal)
-					}
-					if size := query.Get("size"); size != "" {
-						sizeVal, err := strconv.ParseUint(size, 10, 32)
-						if err != nil {
-							return nil, err
-						}
-						req.Size = uint32(sizeVal)
-					}
-					return client.SearchRooms(ctx, &req)
-
-				default:
-					return nil, errors.New("unsupported method")
-				}
-
-			default:
-				return nil, errors.New("path not found: " + path)
+	var err error
+	if route.input, err = protoregistry.GlobalTypes.FindMessageByName(method.Input().FullName()); err != nil {
+		return Route{}, err
+	}
+	if route.output, err = protoregistry.GlobalTypes.FindMessageByName(method.Output().FullName()); err != nil {
+		return Route{}, err
+	}
+
+	fields := method.Input().Fields()
+	if route.Body != "" && route.Body != "*" {
+		field := fields.ByName(protoreflect.Name(route.Body))
+		if field == nil || field.Message() == nil || field.IsList() || field.IsMap() {
+			return Route{}, fmt.Errorf("body %q must be a message field", route.Body)
+		}
+	}
+
+	route.segments = strings.Split(strings.TrimPrefix(route.Path, "/"), "/")
+	pathFields := map[protoreflect.Name]bool{}
+	for _, segment := range route.segments {
+		name, ok := pathParam(segment)
+		if !ok {
+			continue
+		}
+		pathFields[protoreflect.Name(name)] = true
+		field := fields.ByName(protoreflect.Name(name))
+		if field == nil {
+			return Route{}, fmt.Errorf("path %s: unknown field %q", route.Path, name)
+		}
+		if field.IsList() || field.IsMap() || field.Message() != nil {
+			return Route{}, fmt.Errorf("path %s: only scalar fields can be bound", route.Path)
+		}
+	}
+
+	for i := 0; i < fields.Len(); i++ {
+		field := fields.Get(i)
+		if caller, _ := proto.GetExtension(field.Options(), gatewayPb.E_CallerId).(bool); caller && !pathFields[field.Name()] {
+			if field.Kind() != protoreflect.StringKind || field.IsList() {
+				return Route{}, fmt.Errorf("caller_id field %q must be a string", field.Name())
 			}
-		},
+			route.callers = append(route.callers, field)
+		}
+		behavior, _ := proto.GetExtension(field.Options(), annotations.E_FieldBehavior).([]annotations.FieldBehavior)
+		if slices.Contains(behavior, annotations.FieldBehavior_REQUIRED) {
+			route.required = append(route.required, field)
+		}
 	}
+
 	return route, nil
 }
 
+// имя поля из сегмента {name}; шаблоны вида {name=*} не поддерживаются
+func pathParam(segment string) (string, bool) {
+	if !strings.HasPrefix(segment, "{") || !strings.HasSuffix(segment, "}") {
+		return "", false
+	}
+	return segment[1 : len(segment)-1], true
+}
+
+// значения {name}-сегментов или false, если путь не подходит под шаблон
+func (r *Route) match(path string) (map[string]string, bool) {
+	parts := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	if len(parts) != len(r.segments) {
+		return nil, false
+	}
+
+	params := map[string]string{}
+	for i, segment := range r.segments {
+		if name, ok := pathParam(segment); ok {
+			if parts[i] == "" {
+				return nil, false
+			}
+			params[name] = parts[i]
+			continue
+		}
+		if segment != parts[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+// маршрут по методу и пути; route == nil и pathFound == true — путь есть, но метод не поддерживается
+func (s GRPCServiceRoute) lookup(method, path string) (route *Route, params map[string]string, pathFound bool) {
+	for i := range s.Routes {
+		params, ok := s.Routes[i].match(path)
+		if !ok {
+			continue
+		}
+		pathFound = true
+		if s.Routes[i].Method == method {
+			return &s.Routes[i], params, true
+		}
+	}
+	return nil, nil, pathFound
+}
+
+// ошибки сборки — ошибки клиента (400)
+func (r *Route) buildRequest(body []byte, query url.Values, params map[string]string, userID string) (proto.Message, error) {
+	msg := r.input.New()
+	fields := msg.Descriptor().Fields()
+
+	switch {
+	case r.Body == "*" && len(body) > 0:
+		if err := unmarshalOptions.Unmarshal(body, msg.Interface()); err != nil {
+			return nil, fmt.Errorf("invalid body: %w", err)
+		}
+	case r.Body != "" && r.Body != "*" && len(body) > 0:
+		field := fields.ByName(protoreflect.Name(r.Body))
+		if err := unmarshalOptions.Unmarshal(body, msg.Mutable(field).Message().Interface()); err != nil {
+			return nil, fmt.Errorf("invalid body: %w", err)
+		}
+	}
+
+	// при body "*" все поля уже пришли в теле, параметры строки запроса не используются
+	if r.Body != "*" {
+		for name, values := range query {
+			field := fields.ByName(protoreflect.Name(name))
+			if field == nil {
+				field = fields.ByJSONName(name)
+			}
+			// неизвестные параметры (например, для обхода кеша) игнорируются
+			if field == nil || string(field.Name()) == r.Body {
+				continue
+			}
+			if err := setQueryField(msg, field, values); err != nil {
+				return nil, fmt.Errorf("invalid %s: %w", name, err)
+			}
+		}
+	}
+
+	for name, raw := range params {
+		field := fields.ByName(protoreflect.Name(name))
+		v, err := parseFieldValue(field, raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", name, err)
+		}
+		msg.Set(field, v)
+	}
+
+	for _, field := range r.callers {
+		msg.Set(field, protoreflect.ValueOfString(userID))
+	}
+
+	for _, field := range r.required {
+		if !msg.Has(field) {
+			return nil, fmt.Errorf("%s is required", field.Name())
+		}
+	}
+
+	return msg.Interface(), nil
+}
+
+// шаблон нового маршрута с подставленными значениями полей запроса: /room/api/v1/rooms/{id} → /room/api/v1/rooms/<id>
+func successorURL(template string, req proto.Message) string {
+	msg := req.ProtoReflect()
+	segments := strings.Split(template, "/")
+	for i, segment := range segments {
+		name, ok := pathParam(segment)
+		if !ok {
+			continue
+		}
+		if field := msg.Descriptor().Fields().ByName(protoreflect.Name(name)); field != nil && msg.Has(field) {
+			segments[i] = url.PathEscape(msg.Get(field).String())
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+func setQueryField(msg protoreflect.Message, field protoreflect.FieldDescriptor, values []string) error {
+	if field.IsMap() || field.Message() != nil {
+		return fmt.Errorf("cannot be set from query parameters")
+	}
+	if field.IsList() {
+		list := msg.Mutable(field).List()
+		for _, raw := range values {
+			v, err := parseFieldValue(field, raw)
+			if err != nil {
+				return err
+			}
+			list.Append(v)
+		}
+		return nil
+	}
+	if len(values) == 0 || values[0] == "" {
+		return nil
+	}
+	v, err := parseFieldValue(field, values[0])
+	if err != nil {
+		return err
+	}
+	msg.Set(field, v)
+	return nil
+}
+
+func parseFieldValue(field protoreflect.FieldDescriptor, raw string) (protoreflect.Value, error) {
+	switch field.Kind() {
+	case protoreflect.StringKind:
+		return protoreflect.ValueOfString(raw), nil
+	case protoreflect.BoolKind:
+		v, err := strconv.ParseBool(raw)
+		return protoreflect.ValueOfBool(v), err
+	case protoreflect.EnumKind:
+		if value := field.Enum().Values().ByName(protoreflect.Name(raw)); value != nil {
+			return protoreflect.ValueOfEnum(value.Number()), nil
+		}
+		v, err := strconv.ParseInt(raw, 10, 32)
+		return protoreflect.ValueOfEnum(protoreflect.EnumNumber(v)), err
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		v, err := strconv.ParseInt(raw, 10, 32)
+		return protoreflect.ValueOfInt32(int32(v)), err
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		v, err := strconv.ParseUint(raw, 10, 32)
+		return protoreflect.ValueOfUint32(uint32(v)), err
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		v, err := strconv.ParseInt(raw, 10, 64)
+		return protoreflect.ValueOfInt64(v), err
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		v, err := strconv.ParseUint(raw, 10, 64)
+		return protoreflect.ValueOfUint64(v), err
+	case protoreflect.FloatKind:
+		v, err := strconv.ParseFloat(raw, 32)
+		return protoreflect.ValueOfFloat32(float32(v)), err
+	case protoreflect.DoubleKind:
+		v, err := strconv.ParseFloat(raw, 64)
+		return protoreflect.ValueOfFloat64(v), err
+	default:
+		return protoreflect.Value{}, fmt.Errorf("unsupported field kind %s", field.Kind())
+	}
+}
+
 // Универсальный HTTP-хендлер для REST → gRPC
-// Привязка rest-префикса к gRPC-сервису
+// Привязка rest-префикса к gRPC-сервису, маршруты берутся из аннотаций google.api.http
 func ProxyHandler(grpcServiceRoute GRPCServiceRoute) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		userId := r.Context().Value("userId")
 		if userId == nil {
-			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			writeProblem(w, r, http.StatusUnauthorized, "UNAUTHENTICATED", "authentication required")
+			return
+		}
+
+		route, params, pathFound := grpcServiceRoute.lookup(r.Method, r.URL.Path)
+		if route == nil {
+			if pathFound {
+				writeProblem(w, r, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "unsupported method "+r.Method)
+				return
+			}
+			writeProblem(w, r, http.StatusNotFound, "ROUTE_NOT_FOUND", "path not found: "+strings.TrimPrefix(r.URL.Path, grpcServiceRoute.Prefix))
 			return
 		}
 
-		body := make([]byte, r.ContentLength)
-		r.Body.Read(body)
+		// спан HTTP-запроса называется по шаблону маршрута, а не по конкретному пути с id
+		span := trace.SpanFromContext(r.Context())
+		span.SetName(route.Method + " " + route.Path)
+		span.SetAttributes(attribute.String("http.route", route.Path))
+		setRouteLabel(r, route.Path)
 
-		ctx := context.WithValue(r.Context(), "requestPath", r.URL.Path)
-		ctx = context.WithValue(ctx, "requestMethod", r.Method)
-		ctx = context.WithValue(ctx, "requestQuery", r.URL.Query())
+		caller := callerFromRequest(r)
+		if len(route.Roles) > 0 && !caller.HasRole(route.Roles...) {
+			writeProblem(w, r, http.StatusForbidden, "PERMISSION_DENIED", "insufficient role")
+			return
+		}
 
-		resp, err := grpcServiceRoute.Call(ctx, grpcServiceRoute.Conn, userId.(string), body)
+		// запрос по API-ключу: чтение требует <Scope>:read, остальные методы — <Scope>:write
+		if scopes, ok := r.Context().Value("apiKeyScopes").([]string); ok {
+			required := grpcServiceRoute.Scope + ":write"
+			if r.Method == http.MethodGet {
+				required = grpcServiceRoute.Scope + ":read"
+			}
+			if !slices.Contains(scopes, required) {
+				writeProblem(w, r, http.StatusForbidden, "INSUFFICIENT_SCOPE", "api key has no "+required+" scope")
+				return
+			}
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxProxyBodySize))
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			writeProblem(w, r, http.StatusRequestEntityTooLarge, "BODY_TOO_LARGE", fmt.Sprintf("body exceeds %d bytes", maxBytesErr.Limit))
+			return
+		}
+		if err != nil {
+			writeProblem(w, r, http.StatusBadRequest, "INVALID_BODY", "failed to read body")
+			return
+		}
+
+		req, err := route.buildRequest(body, r.URL.Query(), params, userId.(string))
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusNotFound)
+			writeProblem(w, r, http.StatusBadRequest, "INVALID_ARGUMENT", err.Error())
 			return
 		}
 
+		if route.Successor != "" {
+			w.Header().Set("Deprecation", "true")
+			w.Header().Set("Link", fmt.Sprintf("<%s>; rel=\"successor-version\"", successorURL(route.Successor, req)))
+		}
+
+		// токен и request ID передаются сервису через gRPC metadata, пользователя сервис получает из Introspect
+		ctx := common.OutgoingAuthorizationContext(r.Context(), r.Header.Get("Authorization"))
+		ctx = common.OutgoingRequestIDContext(ctx)
+		resp := route.output.New().Interface()
+		if err := grpcServiceRoute.Conn.Invoke(ctx, route.GRPCMethod, req, resp); err != nil {
+			writeGRPCError(w, r, err)
+			return
+		}
+
+		data, err := marshalOptions.Marshal(resp)
+		if err != nil {
+			writeProblem(w, r, http.StatusInternalServerError, "INTERNAL", http.StatusText(http.StatusInternalServerError))
+			return
+		}
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(resp)
+		w.Write(data)
 	}
 }
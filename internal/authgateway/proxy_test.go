@@ -0,0 +1,214 @@
+package authgateway
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	roomPb "github.com/quizverse3D/Backend/internal/pb/room"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// маршрут RoomService по методу и шаблону пути, как его строит gateway при старте
+func roomRoute(t *testing.T, method, path string) *Route {
+	t.Helper()
+	routes, err := serviceRoutes(protoreflect.FullName(roomPb.RoomService_ServiceDesc.ServiceName))
+	if err != nil {
+		t.Fatalf("serviceRoutes: %v", err)
+	}
+	for i := range routes {
+		if routes[i].Method == method && routes[i].Path == path {
+			return &routes[i]
+		}
+	}
+	t.Fatalf("route %s %s not found", method, path)
+	return nil
+}
+
+// ошибки, на которых ProxyHandler отвечает сам, не доходя до gRPC-сервиса
+func TestProxyHandlerProblems(t *testing.T) {
+	route, err := NewGrpcServiceRoute("127.0.0.1:1", "/room/api/v1/", "rooms", roomPb.RoomService_ServiceDesc.ServiceName, RoutePolicies)
+	if err != nil {
+		t.Fatalf("NewGrpcServiceRoute: %v", err)
+	}
+	t.Cleanup(func() { route.Conn.Close() })
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		userID     string
+		roles      []string
+		wantStatus int
+		wantCode   string
+	}{
+		{"anonymous", http.MethodGet, "/room/api/v1/rooms", "", "", nil, http.StatusUnauthorized, "UNAUTHENTICATED"},
+		{"unknown path", http.MethodGet, "/room/api/v1/nope", "", "u1", nil, http.StatusNotFound, "ROUTE_NOT_FOUND"},
+		{"unsupported method", http.MethodPut, "/room/api/v1/rooms", "", "u1", nil, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED"},
+		{"missing role", http.MethodDelete, "/room/api/v1/admin/rooms/r1", "", "u1", nil, http.StatusForbidden, "PERMISSION_DENIED"},
+		{"body too large", http.MethodPost, "/room/api/v1/rooms", `{"name":"` + strings.Repeat("a", maxProxyBodySize) + `"}`, "u1", nil, http.StatusRequestEntityTooLarge, "BODY_TOO_LARGE"},
+		{"invalid body", http.MethodPost, "/room/api/v1/rooms", `{"name":`, "u1", nil, http.StatusBadRequest, "INVALID_ARGUMENT"},
+		{"missing required field", http.MethodGet, "/room/api/v1/room", "", "u1", nil, http.StatusBadRequest, "INVALID_ARGUMENT"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			ctx := r.Context()
+			if tt.userID != "" {
+				ctx = context.WithValue(ctx, "userId", tt.userID)
+				ctx = context.WithValue(ctx, "userRoles", tt.roles)
+			}
+			w := httptest.NewRecorder()
+			ProxyHandler(route)(w, r.WithContext(ctx))
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (%s)", w.Code, tt.wantStatus, w.Body)
+			}
+			if ct := w.Header().Get("Content-Type"); ct != "application/problem+json" {
+				t.Errorf("content type = %q, want application/problem+json", ct)
+			}
+			var problem Problem
+			if err := json.NewDecoder(w.Body).Decode(&problem); err != nil {
+				t.Fatalf("decode problem: %v", err)
+			}
+			if problem.Code != tt.wantCode || problem.Status != tt.wantStatus {
+				t.Errorf("problem = %+v, want code %s status %d", problem, tt.wantCode, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestRouteMatch(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		route  string
+		path   string
+		want   map[string]string
+		ok     bool
+	}{
+		{"static path", http.MethodGet, "/room/api/v1/rooms", "/room/api/v1/rooms", map[string]string{}, true},
+		{"static path with trailing slash", http.MethodGet, "/room/api/v1/rooms", "/room/api/v1/rooms/", nil, false},
+		{"path parameter", http.MethodGet, "/room/api/v1/rooms/{id}", "/room/api/v1/rooms/r1", map[string]string{"id": "r1"}, true},
+		{"empty path parameter", http.MethodGet, "/room/api/v1/rooms/{id}", "/room/api/v1/rooms/", nil, false},
+		{"extra segment", http.MethodGet, "/room/api/v1/rooms/{id}", "/room/api/v1/rooms/r1/players", nil, false},
+		{"missing segment", http.MethodGet, "/room/api/v1/rooms/{id}", "/room/api/v1", nil, false},
+		{"other static segment", http.MethodGet, "/room/api/v1/rooms/{id}", "/room/api/v1/users/r1", nil, false},
+		{"parameter after static prefix", http.MethodDelete, "/room/api/v1/admin/rooms/{id}", "/room/api/v1/admin/rooms/r1", map[string]string{"id": "r1"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			route := roomRoute(t, tt.method, tt.route)
+
+			params, ok := route.match(tt.path)
+			if ok != tt.ok {
+				t.Fatalf("match(%q) ok = %v, want %v", tt.path, ok, tt.ok)
+			}
+			if !maps.Equal(params, tt.want) {
+				t.Errorf("match(%q) params = %v, want %v", tt.path, params, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildRequest(t *testing.T) {
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		body    string
+		query   url.Values
+		params  map[string]string
+		want    proto.Message
+		wantErr bool
+	}{
+		{
+			name:   "body star",
+			method: http.MethodPost, path: "/room/api/v1/rooms",
+			body: `{"name":"quiz","max_players":4,"is_public":true}`,
+			want: &roomPb.CreateRoomParamsRequest{UserUuid: "u1", Name: "quiz", MaxPlayers: 4, IsPublic: true},
+		},
+		{
+			name:   "caller_id is not taken from body",
+			method: http.MethodPost, path: "/room/api/v1/rooms",
+			body: `{"user_uuid":"someone-else","name":"quiz"}`,
+			want: &roomPb.CreateRoomParamsRequest{UserUuid: "u1", Name: "quiz"},
+		},
+		{
+			name:   "query ignored with body star",
+			method: http.MethodPost, path: "/room/api/v1/rooms",
+			query: url.Values{"name": {"from-query"}},
+			want:  &roomPb.CreateRoomParamsRequest{UserUuid: "u1"},
+		},
+		{
+			name:   "invalid body",
+			method: http.MethodPost, path: "/room/api/v1/rooms",
+			body:    `{"name":`,
+			wantErr: true,
+		},
+		{
+			name:   "path parameter",
+			method: http.MethodGet, path: "/room/api/v1/rooms/{id}",
+			params: map[string]string{"id": "r1"},
+			want:   &roomPb.GetRoomParamsRequest{Id: "r1"},
+		},
+		{
+			name:   "legacy query parameter",
+			method: http.MethodGet, path: "/room/api/v1/room",
+			query: url.Values{"id": {"r1"}},
+			want:  &roomPb.GetRoomParamsRequest{Id: "r1"},
+		},
+		{
+			name:   "missing required field",
+			method: http.MethodGet, path: "/room/api/v1/room",
+			wantErr: true,
+		},
+		{
+			name:   "query parameters with unknown ones",
+			method: http.MethodGet, path: "/room/api/v1/rooms",
+			query: url.Values{"query": {"abc"}, "page": {"2"}, "size": {"10"}, "_": {"123"}},
+			want:  &roomPb.SearchRoomsRequest{Query: "abc", Page: 2, Size: 10},
+		},
+		{
+			name:   "invalid numeric query parameter",
+			method: http.MethodGet, path: "/room/api/v1/rooms",
+			query:   url.Values{"page": {"two"}},
+			wantErr: true,
+		},
+		{
+			name:   "path parameter and caller",
+			method: http.MethodDelete, path: "/room/api/v1/rooms/{id}",
+			params: map[string]string{"id": "r1"},
+			want:   &roomPb.DeleteRoomRequest{Id: "r1", UserUuid: "u1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			route := roomRoute(t, tt.method, tt.path)
+
+			got, err := route.buildRequest([]byte(tt.body), tt.query, tt.params, "u1")
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("buildRequest = %v, want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("buildRequest: %v", err)
+			}
+			if !proto.Equal(got, tt.want) {
+				t.Errorf("buildRequest = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,366 @@
+package authgateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// эндпоинты с собственными лимитами
+const (
+	EndpointLogin          = "login"
+	EndpointRegister       = "register"
+	EndpointRefresh        = "refresh"
+	EndpointUpdatePassword = "update-password"
+	EndpointGuest          = "guest"
+	EndpointForgotPassword = "forgot-password"
+	EndpointVerifyResend   = "verify-email-resend"
+)
+
+// не более Requests запросов за скользящее окно Window; Requests == 0 — без ограничения
+type Limit struct {
+	Requests int
+	Window   time.Duration
+}
+
+// лимиты эндпоинта по IP клиента и по аккаунту (email или userID)
+type EndpointLimits struct {
+	PerIP      Limit
+	PerAccount Limit
+}
+
+// временная блокировка после Threshold неудачных попыток за Window,
+// каждая следующая блокировка вдвое длиннее предыдущей (от Base до Max)
+type LockoutConfig struct {
+	Threshold int
+	Window    time.Duration
+	Base      time.Duration
+	Max       time.Duration
+}
+
+type RateLimitError struct {
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("too many requests, retry after %s", e.RetryAfter)
+}
+
+func defaultRateLimits() map[string]EndpointLimits {
+	return map[string]EndpointLimits{
+		EndpointLogin:          {PerIP: Limit{20, time.Minute}, PerAccount: Limit{10, time.Minute}},
+		EndpointRegister:       {PerIP: Limit{5, time.Hour}, PerAccount: Limit{3, time.Hour}},
+		EndpointRefresh:        {PerIP: Limit{60, time.Minute}},
+		EndpointUpdatePassword: {PerIP: Limit{10, time.Minute}, PerAccount: Limit{5, 15 * time.Minute}},
+		EndpointGuest:          {PerIP: Limit{10, time.Hour}},
+		EndpointForgotPassword: {PerIP: Limit{10, time.Hour}, PerAccount: Limit{3, time.Hour}},
+		EndpointVerifyResend:   {PerIP: Limit{10, time.Hour}, PerAccount: Limit{3, time.Hour}},
+	}
+}
+
+func defaultLockout() LockoutConfig {
+	return LockoutConfig{Threshold: 5, Window: 15 * time.Minute, Base: time.Minute, Max: time.Hour}
+}
+
+// формат "<requests>/<window>", например "10/1m"
+func parseLimit(raw string) (Limit, error) {
+	count, window, ok := strings.Cut(raw, "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("invalid rate limit %q", raw)
+	}
+	n, err := strconv.Atoi(count)
+	if err != nil || n < 0 {
+		return Limit{}, fmt.Errorf("invalid rate limit %q", raw)
+	}
+	d, err := time.ParseDuration(window)
+	if err != nil || d <= 0 {
+		return Limit{}, fmt.Errorf("invalid rate limit %q", raw)
+	}
+	return Limit{Requests: n, Window: d}, nil
+}
+
+type RateLimiter struct {
+	redisClient *redis.Client
+	limits      map[string]EndpointLimits
+	lockout     LockoutConfig
+}
+
+func NewRateLimiter(redisClient *redis.Client, limits map[string]EndpointLimits, lockout LockoutConfig) *RateLimiter {
+	return &RateLimiter{redisClient: redisClient, limits: limits, lockout: lockout}
+}
+
+// учитывает запрос к эндпоинту по IP и по аккаунту (пустой account не учитывается)
+func (l *RateLimiter) Allow(ctx context.Context, endpoint, ip, account string) error {
+	limits := l.limits[endpoint]
+	if ip != "" {
+		if err := l.hit(ctx, fmt.Sprintf("ratelimit:%s:ip:%s", endpoint, ip), limits.PerIP); err != nil {
+			return err
+		}
+	}
+	if account != "" {
+		if err := l.hit(ctx, fmt.Sprintf("ratelimit:%s:account:%s", endpoint, strings.ToLower(account)), limits.PerAccount); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// скользящее окно на sorted set: score — время запроса в миллисекундах
+func (l *RateLimiter) hit(ctx context.Context, key string, limit Limit) error {
+	if limit.Requests == 0 {
+		return nil
+	}
+
+	allowed, _, oldest, err := l.addToWindow(ctx, key, limit)
+	if err != nil {
+		return err
+	}
+	if allowed {
+		return nil
+	}
+
+	return &RateLimitError{RetryAfter: time.Until(oldest.Add(limit.Window))}
+}
+
+// KEYS[1] — окно; ARGV: лимит, длина окна в мс, текущее время в мс, уникальный member.
+// Запрос записывается, только если окно не заполнено: отклонённые попытки не продлевают
+// блокировку дальше выданного Retry-After и не раздувают sorted set
+var slidingWindowScript = redis.NewScript(`
+local limit = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now - window)
+local count = redis.call('ZCARD', KEYS[1])
+if count < limit then
+	redis.call('ZADD', KEYS[1], now, ARGV[4])
+	redis.call('PEXPIRE', KEYS[1], window)
+	return {1, count + 1, now}
+end
+local oldest = redis.call('ZRANGE', KEYS[1], 0, 0, 'WITHSCORES')
+return {0, count, tonumber(oldest[2])}
+`)
+
+// allowed — запрос уместился в окно и записан; count — запросов в окне; oldest — самый старый из них
+func (l *RateLimiter) addToWindow(ctx context.Context, key string, limit Limit) (allowed bool, count int64, oldest time.Time, err error) {
+	res, err := slidingWindowScript.Run(ctx, l.redisClient, []string{key},
+		limit.Requests, limit.Window.Milliseconds(), time.Now().UnixMilli(), uuid.NewString()).Int64Slice()
+	if err != nil {
+		return false, 0, time.Time{}, err
+	}
+	if len(res) != 3 {
+		return false, 0, time.Time{}, fmt.Errorf("unexpected sliding window reply %v", res)
+	}
+	return res[0] == 1, res[1], time.UnixMilli(res[2]), nil
+}
+
+// состояние token bucket после запроса
+type BucketState struct {
+	Allowed    bool
+	Remaining  int
+	Reset      time.Duration // до полного пополнения корзины
+	RetryAfter time.Duration // до появления следующего токена, если запрос отклонён
+}
+
+// KEYS[1] — корзина; ARGV: ёмкость, время полного пополнения в мс, текущее время в мс.
+// Дробный остаток токенов возвращается строкой, иначе Redis округлит его до целого
+var tokenBucketScript = redis.NewScript(`
+local capacity = tonumber(ARGV[1])
+local period = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local bucket = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(bucket[1]) or capacity
+local ts = tonumber(bucket[2]) or now
+tokens = math.min(capacity, tokens + math.max(0, now - ts) * capacity / period)
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', now)
+redis.call('PEXPIRE', KEYS[1], period)
+return {allowed, tostring(tokens)}
+`)
+
+// token bucket: ёмкость limit.Requests, корзина пополняется полностью за limit.Window
+func (l *RateLimiter) Take(ctx context.Context, key string, limit Limit) (BucketState, error) {
+	if limit.Requests == 0 {
+		return BucketState{Allowed: true}, nil
+	}
+
+	res, err := tokenBucketScript.Run(ctx, l.redisClient, []string{key},
+		limit.Requests, limit.Window.Milliseconds(), time.Now().UnixMilli()).Slice()
+	if err != nil {
+		return BucketState{}, err
+	}
+	if len(res) != 2 {
+		return BucketState{}, fmt.Errorf("unexpected token bucket reply %v", res)
+	}
+	allowed, _ := res[0].(int64)
+	raw, _ := res[1].(string)
+	tokens, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return BucketState{}, fmt.Errorf("unexpected token bucket reply %v", res)
+	}
+
+	perToken := float64(limit.Window) / float64(limit.Requests)
+	state := BucketState{
+		Allowed:   allowed == 1,
+		Remaining: int(tokens),
+		Reset:     time.Duration((float64(limit.Requests) - tokens) * perToken),
+	}
+	if !state.Allowed {
+		state.RetryAfter = time.Duration((1 - tokens) * perToken)
+	}
+	return state, nil
+}
+
+// RateLimitError, если субъект сейчас заблокирован после неудачных попыток
+func (l *RateLimiter) CheckLockout(ctx context.Context, endpoint, subject string) error {
+	ttl, err := l.redisClient.PTTL(ctx, lockoutKey(endpoint, subject)).Result()
+	if err != nil {
+		return err
+	}
+	if ttl > 0 {
+		return &RateLimitError{RetryAfter: ttl}
+	}
+	return nil
+}
+
+// неудачная попытка; при достижении порога субъект блокируется с экспоненциальным ростом срока
+func (l *RateLimiter) RegisterFailure(ctx context.Context, endpoint, subject string) error {
+	if l.lockout.Threshold == 0 {
+		return nil
+	}
+
+	failuresKey := fmt.Sprintf("failures:%s:%s", endpoint, subject)
+	_, count, _, err := l.addToWindow(ctx, failuresKey, Limit{Requests: l.lockout.Threshold, Window: l.lockout.Window})
+	if err != nil {
+		return err
+	}
+	if count < int64(l.lockout.Threshold) {
+		return nil
+	}
+
+	// номер блокировки помнится сутки
+	strikesKey := fmt.Sprintf("lockout_strikes:%s:%s", endpoint, subject)
+	strikes, err := l.redisClient.Incr(ctx, strikesKey).Result()
+	if err != nil {
+		return err
+	}
+	l.redisClient.Expire(ctx, strikesKey, 24*time.Hour)
+
+	duration := l.lockout.Max
+	if strikes <= 32 {
+		duration = time.Duration(math.Min(float64(l.lockout.Base)*math.Pow(2, float64(strikes-1)), float64(l.lockout.Max)))
+	}
+
+	_, err = l.redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, lockoutKey(endpoint, subject), 1, duration)
+		pipe.Del(ctx, failuresKey)
+		return nil
+	})
+	return err
+}
+
+// успешная попытка сбрасывает счётчики неудач
+func (l *RateLimiter) Reset(ctx context.Context, endpoint, subject string) error {
+	return l.redisClient.Del(ctx,
+		fmt.Sprintf("failures:%s:%s", endpoint, subject),
+		fmt.Sprintf("lockout_strikes:%s:%s", endpoint, subject),
+	).Err()
+}
+
+func lockoutKey(endpoint, subject string) string {
+	return fmt.Sprintf("lockout:%s:%s", endpoint, subject)
+}
+
+// IP клиента. Заголовки прокси учитываются, только если запрос пришёл от доверенного прокси;
+// в X-Forwarded-For берётся самый правый адрес, не принадлежащий доверенным прокси:
+// всё левее него клиент мог подставить сам
+func clientIP(r *http.Request, trustedProxies []netip.Prefix) string {
+	remote := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		remote = host
+	}
+	if !isTrustedProxy(remote, trustedProxies) {
+		return remote
+	}
+
+	if forwarded := r.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+		hops := strings.Split(strings.Join(forwarded, ","), ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			if _, err := netip.ParseAddr(hop); err != nil {
+				// мусор в цепочке: дальше доверять ей нельзя
+				return remote
+			}
+			if !isTrustedProxy(hop, trustedProxies) {
+				return hop
+			}
+		}
+		// вся цепочка из доверенных прокси — клиент внутри периметра
+		return strings.TrimSpace(hops[0])
+	}
+	if realIP := strings.TrimSpace(r.Header.Get("X-Real-IP")); realIP != "" {
+		if _, err := netip.ParseAddr(realIP); err == nil {
+			return realIP
+		}
+	}
+
+	return remote
+}
+
+func isTrustedProxy(ip string, trustedProxies []netip.Prefix) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// заголовки RateLimit-* (draft-ietf-httpapi-ratelimit-headers); время — в целых секундах, не меньше 1
+func writeRateLimitHeaders(w http.ResponseWriter, limit Limit, state BucketState) {
+	w.Header().Set("RateLimit-Limit", strconv.Itoa(limit.Requests))
+	w.Header().Set("RateLimit-Remaining", strconv.Itoa(state.Remaining))
+	w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(state.Reset)))
+	w.Header().Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", limit.Requests, ceilSeconds(limit.Window)))
+	if !state.Allowed {
+		w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(state.RetryAfter)))
+	}
+}
+
+func ceilSeconds(d time.Duration) int {
+	seconds := int(math.Ceil(d.Seconds()))
+	if seconds < 1 {
+		return 1
+	}
+	return seconds
+}
+
+// 429 с Retry-After; false, если err не связан с лимитами
+func writeRateLimitError(w http.ResponseWriter, err error) bool {
+	var rlErr *RateLimitError
+	if !errors.As(err, &rlErr) {
+		return false
+	}
+
+	w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(rlErr.RetryAfter)))
+	http.Error(w, "too many requests", http.StatusTooManyRequests)
+	return true
+}
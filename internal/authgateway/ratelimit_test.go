@@ -0,0 +1,249 @@
+package authgateway
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/quizverse3D/Backend/internal/testutil"
+)
+
+func TestRateLimiterTake(t *testing.T) {
+	tests := []struct {
+		name          string
+		limit         Limit
+		wantAllowed   []bool
+		wantRemaining int
+	}{
+		{"within capacity", Limit{Requests: 3, Window: time.Minute}, []bool{true, true, true}, 0},
+		{"partially used", Limit{Requests: 5, Window: time.Minute}, []bool{true, true}, 3},
+		{"over capacity", Limit{Requests: 2, Window: time.Minute}, []bool{true, true, false, false}, 0},
+		{"unlimited", Limit{}, []bool{true, true, true, true}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mr, rc := testutil.NewRedis(t)
+			limiter := NewRateLimiter(rc, nil, LockoutConfig{})
+			perToken := time.Duration(0)
+			if tt.limit.Requests > 0 {
+				perToken = tt.limit.Window / time.Duration(tt.limit.Requests)
+			}
+
+			var state BucketState
+			for i, want := range tt.wantAllowed {
+				var err error
+				state, err = limiter.Take(context.Background(), "bucket", tt.limit)
+				if err != nil {
+					t.Fatalf("Take #%d: %v", i, err)
+				}
+				if state.Allowed != want {
+					t.Fatalf("Take #%d allowed = %v, want %v", i, state.Allowed, want)
+				}
+				if state.Allowed && state.RetryAfter != 0 {
+					t.Errorf("Take #%d retry after = %v for allowed request", i, state.RetryAfter)
+				}
+				if !state.Allowed && (state.RetryAfter <= 0 || state.RetryAfter > perToken) {
+					t.Errorf("Take #%d retry after = %v, want (0, %v]", i, state.RetryAfter, perToken)
+				}
+			}
+			if state.Remaining != tt.wantRemaining {
+				t.Errorf("remaining = %d, want %d", state.Remaining, tt.wantRemaining)
+			}
+			if state.Reset > tt.limit.Window {
+				t.Errorf("reset = %v, longer than window %v", state.Reset, tt.limit.Window)
+			}
+
+			// корзина не должна жить в Redis дольше окна
+			if tt.limit.Requests == 0 {
+				if mr.Exists("bucket") {
+					t.Error("unlimited bucket stored in redis")
+				}
+			} else if ttl := mr.TTL("bucket"); ttl <= 0 || ttl > tt.limit.Window {
+				t.Errorf("bucket ttl = %v, want (0, %v]", ttl, tt.limit.Window)
+			}
+		})
+	}
+}
+
+func TestRateLimiterTakeRefill(t *testing.T) {
+	_, rc := testutil.NewRedis(t)
+	limiter := NewRateLimiter(rc, nil, LockoutConfig{})
+	limit := Limit{Requests: 1, Window: 50 * time.Millisecond}
+
+	steps := []struct {
+		wait        time.Duration
+		wantAllowed bool
+	}{
+		{0, true},
+		{0, false},
+		{60 * time.Millisecond, true},
+		{0, false},
+	}
+	for i, step := range steps {
+		time.Sleep(step.wait)
+		state, err := limiter.Take(context.Background(), "bucket", limit)
+		if err != nil {
+			t.Fatalf("Take #%d: %v", i, err)
+		}
+		if state.Allowed != step.wantAllowed {
+			t.Fatalf("Take #%d allowed = %v, want %v", i, state.Allowed, step.wantAllowed)
+		}
+	}
+}
+
+func TestRateLimiterTakeRedisDown(t *testing.T) {
+	mr, rc := testutil.NewRedis(t)
+	limiter := NewRateLimiter(rc, nil, LockoutConfig{})
+	mr.Close()
+
+	if _, err := limiter.Take(context.Background(), "bucket", Limit{Requests: 1, Window: time.Minute}); err == nil {
+		t.Fatal("Take with redis down: want error")
+	}
+}
+
+func TestRateLimiterAllow(t *testing.T) {
+	tests := []struct {
+		name        string
+		limits      EndpointLimits
+		ip, account string
+		attempts    int
+		allowed     int
+		// ключ окна и сколько в нём записей после всех попыток
+		key     string
+		wantLen int
+	}{
+		{"per ip", EndpointLimits{PerIP: Limit{2, time.Minute}}, "203.0.113.5", "", 5, 2, "ratelimit:login:ip:203.0.113.5", 2},
+		{"per account, case-insensitive", EndpointLimits{PerAccount: Limit{3, time.Minute}}, "", "User@Example.com", 10, 3, "ratelimit:login:account:user@example.com", 3},
+		{"unlimited", EndpointLimits{}, "203.0.113.5", "user@example.com", 5, 5, "ratelimit:login:ip:203.0.113.5", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mr, rc := testutil.NewRedis(t)
+			limiter := NewRateLimiter(rc, map[string]EndpointLimits{EndpointLogin: tt.limits}, LockoutConfig{})
+
+			allowed := 0
+			for i := 0; i < tt.attempts; i++ {
+				err := limiter.Allow(context.Background(), EndpointLogin, tt.ip, tt.account)
+				var rateLimitErr *RateLimitError
+				switch {
+				case err == nil:
+					allowed++
+				case errors.As(err, &rateLimitErr):
+					if rateLimitErr.RetryAfter <= 0 || rateLimitErr.RetryAfter > time.Minute {
+						t.Errorf("attempt #%d retry after = %v, want (0, 1m]", i, rateLimitErr.RetryAfter)
+					}
+				default:
+					t.Fatalf("attempt #%d: %v", i, err)
+				}
+			}
+			if allowed != tt.allowed {
+				t.Errorf("allowed %d of %d attempts, want %d", allowed, tt.attempts, tt.allowed)
+			}
+			// отклонённые попытки в окно не записываются
+			members, _ := mr.ZMembers(tt.key)
+			if len(members) != tt.wantLen {
+				t.Errorf("window %s has %d entries, want %d", tt.key, len(members), tt.wantLen)
+			}
+		})
+	}
+}
+
+// клиент, который продолжает стучаться, получает доступ сразу по истечении выданного Retry-After
+func TestRateLimiterAllowAfterRetryAfter(t *testing.T) {
+	_, rc := testutil.NewRedis(t)
+	limits := map[string]EndpointLimits{EndpointLogin: {PerIP: Limit{1, 100 * time.Millisecond}}}
+	limiter := NewRateLimiter(rc, limits, LockoutConfig{})
+	ctx := context.Background()
+
+	if err := limiter.Allow(ctx, EndpointLogin, "203.0.113.5", ""); err != nil {
+		t.Fatalf("first attempt: %v", err)
+	}
+	var deadline time.Time
+	for i := 0; i < 5; i++ {
+		var rateLimitErr *RateLimitError
+		if err := limiter.Allow(ctx, EndpointLogin, "203.0.113.5", ""); !errors.As(err, &rateLimitErr) {
+			t.Fatalf("retry #%d: err = %v, want RateLimitError", i, err)
+		} else if i == 0 {
+			deadline = time.Now().Add(rateLimitErr.RetryAfter)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	time.Sleep(time.Until(deadline) + 10*time.Millisecond)
+	if err := limiter.Allow(ctx, EndpointLogin, "203.0.113.5", ""); err != nil {
+		t.Fatalf("attempt after retry-after: %v", err)
+	}
+}
+
+func TestRateLimiterLockout(t *testing.T) {
+	_, rc := testutil.NewRedis(t)
+	limiter := NewRateLimiter(rc, nil, LockoutConfig{Threshold: 3, Window: time.Minute, Base: time.Minute, Max: time.Hour})
+	ctx := context.Background()
+
+	for i := 1; i <= 3; i++ {
+		if err := limiter.CheckLockout(ctx, EndpointLogin, "u1"); err != nil {
+			t.Fatalf("lockout before failure #%d: %v", i, err)
+		}
+		if err := limiter.RegisterFailure(ctx, EndpointLogin, "u1"); err != nil {
+			t.Fatalf("RegisterFailure #%d: %v", i, err)
+		}
+	}
+	var rateLimitErr *RateLimitError
+	if err := limiter.CheckLockout(ctx, EndpointLogin, "u1"); !errors.As(err, &rateLimitErr) || rateLimitErr.RetryAfter > time.Minute {
+		t.Fatalf("CheckLockout after threshold = %v, want RateLimitError up to 1m", err)
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	trusted := []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("192.0.2.1/32"),
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  []string
+		realIP     string
+		trusted    []netip.Prefix
+		want       string
+	}{
+		{"no trusted proxies", "203.0.113.5:1234", []string{"198.51.100.7"}, "", nil, "203.0.113.5"},
+		{"untrusted remote", "203.0.113.5:1234", []string{"198.51.100.7"}, "198.51.100.8", trusted, "203.0.113.5"},
+		{"remote without port", "203.0.113.5", nil, "", trusted, "203.0.113.5"},
+		{"trusted remote without headers", "10.0.0.1:1234", nil, "", trusted, "10.0.0.1"},
+		{"single hop", "10.0.0.1:1234", []string{"198.51.100.7"}, "", trusted, "198.51.100.7"},
+		{"spoofed leftmost hop", "10.0.0.1:1234", []string{"6.6.6.6, 198.51.100.7"}, "", trusted, "198.51.100.7"},
+		{"chain of trusted proxies", "10.0.0.1:1234", []string{"198.51.100.7, 10.0.0.2, 192.0.2.1"}, "", trusted, "198.51.100.7"},
+		{"several headers", "10.0.0.1:1234", []string{"6.6.6.6", "198.51.100.7"}, "", trusted, "198.51.100.7"},
+		{"only trusted hops", "10.0.0.1:1234", []string{"10.0.0.3, 10.0.0.2"}, "", trusted, "10.0.0.3"},
+		{"garbage hop", "10.0.0.1:1234", []string{"198.51.100.7, garbage"}, "", trusted, "10.0.0.1"},
+		{"ipv6 hop", "10.0.0.1:1234", []string{"2001:db8::1"}, "", trusted, "2001:db8::1"},
+		{"ipv4-mapped trusted remote", "[::ffff:10.0.0.1]:1234", []string{"198.51.100.7"}, "", trusted, "198.51.100.7"},
+		{"real ip", "10.0.0.1:1234", nil, "198.51.100.7", trusted, "198.51.100.7"},
+		{"invalid real ip", "10.0.0.1:1234", nil, "not-an-ip", trusted, "10.0.0.1"},
+		{"forwarded wins over real ip", "10.0.0.1:1234", []string{"198.51.100.7"}, "198.51.100.8", trusted, "198.51.100.7"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for _, v := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", v)
+			}
+			if tt.realIP != "" {
+				r.Header.Set("X-Real-IP", tt.realIP)
+			}
+
+			if got := clientIP(r, tt.trusted); got != tt.want {
+				t.Errorf("clientIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,28 @@
+package authgateway
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/quizverse3D/Backend/internal/common"
+)
+
+// правила для отдельных REST-маршрутов; сами маршруты задаются аннотациями google.api.http в proto/*.proto
+var RoutePolicies = map[string]RoutePolicy{
+	// каждая комната — запись в Postgres, поиск — запрос с ILIKE
+	http.MethodPost + " /room/api/v1/rooms": {RateLimit: Limit{Requests: 10, Window: time.Minute}},
+	http.MethodGet + " /room/api/v1/rooms":  {RateLimit: Limit{Requests: 60, Window: time.Minute}},
+
+	// владелец не проверяется: room-сервис пропускает администратора и модератора по роли
+	http.MethodDelete + " /room/api/v1/admin/rooms/{id}": {Roles: []string{common.RoleAdmin, common.RoleModerator}},
+
+	// маршруты с id в строке запроса, оставлены на время перехода на /rooms/{id};
+	// квота общая с заменой
+	http.MethodPost + " /room/api/v1/room":   {Successor: "/room/api/v1/rooms"},
+	http.MethodGet + " /room/api/v1/room":    {Successor: "/room/api/v1/rooms/{id}"},
+	http.MethodDelete + " /room/api/v1/room": {Successor: "/room/api/v1/rooms/{id}"},
+	http.MethodDelete + " /room/api/v1/admin/room": {
+		Roles:     []string{common.RoleAdmin, common.RoleModerator},
+		Successor: "/room/api/v1/admin/rooms/{id}",
+	},
+}
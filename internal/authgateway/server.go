@@ -0,0 +1,48 @@
+package authgateway
+
+import (
+	"context"
+
+	"github.com/quizverse3D/Backend/internal/common"
+	pb "github.com/quizverse3D/Backend/internal/pb/auth"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+type Server struct {
+	pb.UnimplementedAuthServiceServer
+	svc *Service
+}
+
+func NewGRPCServer(svc *Service) pb.AuthServiceServer {
+	return &Server{svc: svc}
+}
+
+func (s *Server) Introspect(ctx context.Context, req *pb.IntrospectRequest) (*pb.IntrospectResponse, error) {
+	if req.GetToken() == "" {
+		return nil, status.Error(codes.InvalidArgument, "token is required")
+	}
+
+	info, err := s.svc.Introspect(ctx, req.GetToken())
+	if err != nil {
+		common.Logf(ctx, "failed to introspect token: %v", err)
+		return nil, status.Error(codes.Internal, "introspection failed")
+	}
+	if !info.Active {
+		return &pb.IntrospectResponse{Active: false}, nil
+	}
+
+	resp := &pb.IntrospectResponse{
+		Active:     true,
+		UserId:     info.UserID,
+		Roles:      info.Roles,
+		SessionId:  info.SessionID,
+		Unverified: info.Unverified,
+		Scopes:     info.Scopes,
+	}
+	if !info.ExpiresAt.IsZero() {
+		resp.ExpiresAt = timestamppb.New(info.ExpiresAt)
+	}
+	return resp, nil
+}
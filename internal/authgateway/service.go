@@ -2,97 +2,235 @@ package authgateway
 
 import (
 	"context"
-	"crypto/rand"
-	"encoding/base64"
 	"fmt"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/quizverse3D/Backend/internal/common"
 	"github.com/redis/go-redis/v9"
-	"github.com/streadway/amqp"
-	"golang.org/x/crypto/bcrypt"
 )
 
+const refreshTokenTTL = 7 * 24 * time.Hour
+
+// refresh:<userID>:<sessionID> — refresh-токен конкретной сессии
+func refreshKey(userID, sessionID string) string {
+	return fmt.Sprintf("refresh:%s:%s", userID, sessionID)
+}
+
+// sessions:<userID> — множество активных sessionID пользователя
+func sessionsKey(userID string) string {
+	return fmt.Sprintf("sessions:%s", userID)
+}
+
 type Service struct {
 	storage     *Storage
 	redisClient *redis.Client
-	rabbitChan  *amqp.Channel
+	outbox      *OutboxRelay
+	mailer      common.Mailer
+	limiter     *RateLimiter
+	hasher      *common.PasswordHasher
+	cfg         Config
 }
 
-func NewService(storage *Storage, redisClient *redis.Client, rabbitChan *amqp.Channel) *Service {
-	return &Service{storage: storage, redisClient: redisClient, rabbitChan: rabbitChan}
+func NewService(storage *Storage, redisClient *redis.Client, outbox *OutboxRelay, mailer common.Mailer, cfg Config) *Service {
+	return &Service{
+		storage:     storage,
+		redisClient: redisClient,
+		outbox:      outbox,
+		mailer:      mailer,
+		limiter:     NewRateLimiter(redisClient, cfg.RateLimits, cfg.Lockout),
+		hasher:      common.NewPasswordHasher(cfg.PasswordParams),
+		cfg:         cfg,
+	}
 }
 
-func generateSalt(n int) (string, error) {
-	b := make([]byte, n)
-	if _, err := rand.Read(b); err != nil {
-		return "", err
+// учёт запроса к эндпоинту, RateLimitError при превышении лимита
+func (s *Service) CheckRateLimit(ctx context.Context, endpoint, ip, account string) error {
+	return s.limiter.Allow(ctx, endpoint, ip, account)
+}
+
+// токен из корзины маршрута для субъекта (user:<id> или ip:<addr>)
+func (s *Service) TakeRouteToken(ctx context.Context, route *Route, subject string) (Limit, BucketState, error) {
+	limit := route.RateLimit
+	if limit.Requests == 0 {
+		limit = s.cfg.RouteRateLimit
+	}
+	// устаревший маршрут расходует квоту своей замены, иначе через пару маршрутов квота удваивается
+	path := route.Path
+	if route.Successor != "" {
+		path = route.Successor
 	}
-	return base64.StdEncoding.EncodeToString(b), nil
+	key := fmt.Sprintf("bucket:%s:%s:%s", route.Method, path, subject)
+	state, err := s.limiter.Take(ctx, key, limit)
+	return limit, state, err
 }
 
-func (s *Service) Register(email, password, username string) (string, error) {
-	id := uuid.NewString()
+// проверка пароля по хешу из credentials (argon2id или старый bcrypt с солью)
+func (s *Service) checkPassword(u Auth, password string) (bool, error) {
+	ok, _, err := s.hasher.Verify(password, u.Password, u.PasswordSalt)
+	return ok, err
+}
 
-	salt, err := generateSalt(16)
-	if err != nil {
-		return "", err
+func (s *Service) Register(email, password, username string, client ClientInfo) (id string, err error) {
+	defer func() { s.audit(AuditEntry{Event: AuditRegister, UserID: id, Email: email}, client, err) }()
+
+	if !isValidEmail(email) {
+		return "", ErrInvalidEmail
 	}
-	combined := password + salt
-	hashed, err := bcrypt.GenerateFromPassword([]byte(combined), bcrypt.DefaultCost)
+
+	id = uuid.NewString()
+
+	hashed, err := s.hasher.Hash(password)
 	if err != nil {
 		return "", err
 	}
 
 	u := Auth{
-		ID:           id,
-		Email:        email,
-		Password:     string(hashed),
-		PasswordSalt: salt,
+		ID:       id,
+		Email:    email,
+		Password: hashed,
 	}
 
-	err = s.storage.CreateAuth(u)
+	// профиль в Users создаётся по событию из outbox: регистрация и событие атомарны
+	ctx := client.context()
+	event, err := userRegisteredEvent(ctx, id, username)
 	if err != nil {
 		return "", err
 	}
 
-	err = s.rabbitChan.Publish("", "user_registered", false, false, amqp.Publishing{
-		ContentType: "application/json",
-		Body:        []byte(fmt.Sprintf(`{"userId":"%s","userName":"%s"}`, id, username)),
-	})
+	err = s.storage.CreateAuth(ctx, u, event)
 	if err != nil {
-		return "", fmt.Errorf("failed to publish event: %w", err)
+		return "", err
+	}
+	s.outbox.Notify()
+
+	// письмо можно запросить повторно, поэтому ошибка отправки не отменяет регистрацию
+	if err := s.sendVerificationEmail(ctx, id, email); err != nil {
+		common.Logf(ctx, "failed to send verification email to %s: %v", email, err)
 	}
 
 	return id, nil
 }
 
-func (s *Service) Login(email, password string) (string, string, error) {
-	u, ok := s.storage.GetAuth(email)
+// удаление аккаунта: credentials, все сессии и событие user_deleted для остальных сервисов.
+// У гостей пароля нет, для них подтверждение не требуется.
+func (s *Service) DeleteAccount(userID, password string, client ClientInfo) (err error) {
+	defer func() { s.audit(AuditEntry{Event: AuditAccountDelete, UserID: userID}, client, err) }()
+
+	ctx := client.context()
+	u, err := s.storage.GetCredInfoByUuid(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if !u.Guest {
+		if err := s.verifyCurrentPassword(ctx, u, password); err != nil {
+			return err
+		}
+	}
+
+	// удаление и событие атомарны: профиль и комнаты не останутся без владельца, если брокер недоступен
+	event, err := userDeletedEvent(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if err := s.storage.DeleteAuth(ctx, userID, event); err != nil {
+		return err
+	}
+	s.outbox.Notify()
+
+	if err := s.revokeAllSessions(ctx, userID); err != nil {
+		common.Logf(ctx, "failed to revoke sessions of deleted user %s: %v", userID, err)
+	}
+	return nil
+}
+
+func (s *Service) Login(email, password string, client ClientInfo) (accessToken, refreshToken string, err error) {
+	var userID string
+	defer func() { s.audit(AuditEntry{Event: AuditLogin, UserID: userID, Email: email}, client, err) }()
+
+	ctx := client.context()
+	emailSubject := "email:" + strings.ToLower(email)
+	ipSubject := "ip:" + client.IP
+
+	// блокировка проверяется до bcrypt, чтобы перебор не нагружал CPU
+	for _, subject := range []string{emailSubject, ipSubject} {
+		if err := s.limiter.CheckLockout(ctx, EndpointLogin, subject); err != nil {
+			return "", "", err
+		}
+	}
+
+	u, ok := s.storage.GetAuth(ctx, email)
 	if !ok {
+		s.loginFailed(ctx, emailSubject, ipSubject)
 		return "", "", ErrInvalidCreds
 	}
 
-	combined := password + u.PasswordSalt
-
-	err := bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(combined))
+	userID = u.ID
+	valid, needsRehash, err := s.hasher.Verify(password, u.Password, u.PasswordSalt)
 	if err != nil {
+		return "", "", err
+	}
+	if !valid {
+		s.loginFailed(ctx, emailSubject, ipSubject)
 		return "", "", ErrInvalidCreds
 	}
 
-	accessToken, err := GenerateAccessToken(u.ID)
+	// старый bcrypt-хеш или устаревшие параметры argon2id: пароль известен только сейчас
+	if needsRehash {
+		s.rehashPassword(ctx, u, password)
+	}
+
+	// счётчик по IP не сбрасываем: иначе перебор можно чередовать со входом в свой аккаунт
+	if err := s.limiter.Reset(ctx, EndpointLogin, emailSubject); err != nil {
+		common.Logf(ctx, "failed to reset login failures for %s: %v", email, err)
+	}
+
+	if !u.Verified && s.cfg.UnverifiedLoginPolicy == LoginPolicyDeny {
+		return "", "", ErrEmailNotVerified
+	}
+
+	// при включённой 2FA токены выдаются только после проверки кода (LoginMFA)
+	mfa, ok, err := s.storage.GetMFA(ctx, u.ID)
 	if err != nil {
 		return "", "", err
 	}
+	if ok && mfa.Enabled {
+		mfaToken, err := GenerateMFAPendingToken(u.ID)
+		if err != nil {
+			return "", "", err
+		}
+		return "", "", &MFARequiredError{Token: mfaToken}
+	}
 
-	refreshToken, err := GenerateRefreshToken(u.ID)
+	return s.createSession(ctx, u, client)
+}
+
+// новая сессия (устройство): пара access/refresh и запись refresh-токена в Redis
+func (s *Service) createSession(ctx context.Context, u Auth, client ClientInfo) (string, string, error) {
+	sessionID := uuid.NewString()
+
+	accessToken, err := GenerateAccessToken(u.ID, sessionID, u.Roles, s.isLimited(u))
 	if err != nil {
 		return "", "", err
 	}
 
-	ctx := context.Background()
-	key := fmt.Sprintf("refresh:%s", u.ID)
-	err = s.redisClient.Set(ctx, key, refreshToken, 7*24*time.Hour).Err()
+	refreshToken, err := GenerateRefreshToken(u.ID, sessionID)
+	if err != nil {
+		return "", "", err
+	}
+
+	// у каждого устройства своя сессия, вход на новом устройстве не затирает остальные
+	_, err = s.redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, refreshKey(u.ID, sessionID), refreshToken, refreshTokenTTL)
+		pipe.SAdd(ctx, sessionsKey(u.ID), sessionID)
+		pipe.Expire(ctx, sessionsKey(u.ID), refreshTokenTTL)
+		pipe.HSet(ctx, sessionKey(u.ID, sessionID), "created_at", time.Now().Unix())
+		touchSession(ctx, pipe, u.ID, sessionID, client)
+		return nil
+	})
 	if err != nil {
 		return "", "", err
 	}
@@ -100,52 +238,209 @@ func (s *Service) Login(email, password string) (string, string, error) {
 	return accessToken, refreshToken, nil
 }
 
+// ошибка перехеширования не мешает входу: попробуем при следующем
+func (s *Service) rehashPassword(ctx context.Context, u Auth, password string) {
+	hashed, err := s.hasher.Hash(password)
+	if err != nil {
+		common.Logf(ctx, "failed to rehash password for %s: %v", u.ID, err)
+		return
+	}
+	if err := s.storage.ReplacePasswordHash(ctx, u.ID, u.Password, hashed); err != nil {
+		common.Logf(ctx, "failed to store rehashed password for %s: %v", u.ID, err)
+	}
+}
+
+func (s *Service) loginFailed(ctx context.Context, subjects ...string) {
+	for _, subject := range subjects {
+		if err := s.limiter.RegisterFailure(ctx, EndpointLogin, subject); err != nil {
+			common.Logf(ctx, "failed to register login failure for %s: %v", subject, err)
+		}
+	}
+}
+
 func (s *Service) ValidateAccessToken(tokenStr string) (string, error) {
 	return ValidateAccessToken(tokenStr)
 }
 
-func (s *Service) RefreshAccessToken(refreshToken string) (string, error) {
-	userID, err := ValidateRefreshToken(refreshToken)
+// выдаёт новую пару access/refresh, старый refresh-токен становится недействительным.
+// Повторное предъявление уже использованного refresh-токена отзывает всю сессию (семейство токенов).
+func (s *Service) RefreshAccessToken(refreshToken string, client ClientInfo) (accessToken, newRefreshToken string, err error) {
+	userID, sessionID, err := ValidateRefreshToken(refreshToken)
 	if err != nil {
-		return "", err
+		// поддельный или истёкший токен: пользователь неизвестен, в журнал не пишем
+		return "", "", err
+	}
+	defer func() {
+		s.audit(AuditEntry{Event: AuditRefresh, UserID: userID, Details: "session " + sessionID}, client, err)
+	}()
+
+	newRefreshToken, err = GenerateRefreshToken(userID, sessionID)
+	if err != nil {
+		return "", "", err
 	}
 
-	ctx := context.Background()
-	key := fmt.Sprintf("refresh:%s", userID)
+	ctx := client.context()
+	key := refreshKey(userID, sessionID)
+	err = s.redisClient.Watch(ctx, func(tx *redis.Tx) error {
+		stored, err := tx.Get(ctx, key).Result()
+		if err == redis.Nil {
+			// сессия отозвана (logout) или истекла
+			return ErrInvalidCreds
+		}
+		if err != nil {
+			return err
+		}
+		if stored != refreshToken {
+			return ErrRefreshReused
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, newRefreshToken, refreshTokenTTL)
+			pipe.Expire(ctx, sessionsKey(userID), refreshTokenTTL)
+			touchSession(ctx, pipe, userID, sessionID, client)
+			return nil
+		})
+		return err
+	}, key)
 
-	stored, err := s.redisClient.Get(ctx, key).Result()
-	if err != nil || stored != refreshToken {
-		return "", ErrInvalidCreds
+	if err == ErrRefreshReused {
+		// токен мог быть украден: отзываем всё семейство, обоим владельцам придётся войти заново
+		common.Logf(ctx, "refresh token reuse detected: user %s, session %s revoked", userID, sessionID)
+		if err := s.revokeSession(ctx, userID, sessionID); err != nil {
+			common.Logf(ctx, "failed to revoke session %s: %v", sessionID, err)
+		}
+		return "", "", ErrInvalidCreds
+	}
+	if err == redis.TxFailedErr {
+		// параллельная ротация того же токена уже прошла
+		return "", "", ErrInvalidCreds
+	}
+	if err != nil {
+		return "", "", err
+	}
+
+	// статус подтверждения почты и роли могли измениться с момента входа
+	u, err := s.storage.GetCredInfoByUuid(ctx, userID)
+	if err != nil {
+		return "", "", err
 	}
 
-	return GenerateAccessToken(userID)
+	accessToken, err = GenerateAccessToken(userID, sessionID, u.Roles, s.isLimited(u))
+	if err != nil {
+		return "", "", err
+	}
+
+	return accessToken, newRefreshToken, nil
 }
 
-func (s *Service) UpdatePassword(uuid, newPassword, oldPassword string) error {
-	u, err := s.storage.GetCredInfoByUuid(uuid)
+// завершение сессии, к которой привязан refresh-токен
+func (s *Service) Logout(refreshToken string, client ClientInfo) error {
+	userID, sessionID, err := ValidateRefreshToken(refreshToken)
 	if err != nil {
 		return err
 	}
 
-	salt := u.PasswordSalt
-	combined := oldPassword + salt
+	err = s.revokeSession(client.context(), userID, sessionID)
+	s.audit(AuditEntry{Event: AuditLogout, UserID: userID, Details: "session " + sessionID}, client, err)
+	return err
+}
+
+func (s *Service) revokeSession(ctx context.Context, userID, sessionID string) error {
+	_, err := s.redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, refreshKey(userID, sessionID), sessionKey(userID, sessionID))
+		pipe.SRem(ctx, sessionsKey(userID), sessionID)
+		return nil
+	})
+	return err
+}
 
-	err = bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(combined))
+// завершение всех сессий пользователя на всех устройствах. API-ключи остаются: это доступ
+// интеграций, а не устройств, они отзываются по одному (RevokeAPIKey) или при сбросе пароля
+func (s *Service) LogoutAll(userID string, client ClientInfo) error {
+	err := s.revokeAllSessions(client.context(), userID)
+	s.audit(AuditEntry{Event: AuditLogoutAll, UserID: userID}, client, err)
+	return err
+}
+
+func (s *Service) revokeAllSessions(ctx context.Context, userID string) error {
+	sessionIDs, err := s.redisClient.SMembers(ctx, sessionsKey(userID)).Result()
+	if err != nil {
+		return err
+	}
+
+	_, err = s.redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, sessionID := range sessionIDs {
+			pipe.Del(ctx, refreshKey(userID, sessionID), sessionKey(userID, sessionID))
+		}
+		pipe.Del(ctx, sessionsKey(userID))
+		return nil
+	})
+	return err
+}
+
+// назначение ролей пользователю, вступает в силу при следующем обновлении access-токена
+func (s *Service) SetRoles(actorID, userID string, roles []string, client ClientInfo) (err error) {
+	defer func() {
+		details := fmt.Sprintf("roles %v set by %s", roles, actorID)
+		s.audit(AuditEntry{Event: AuditRolesUpdate, UserID: userID, Details: details}, client, err)
+	}()
+
+	if len(roles) == 0 {
+		return ErrInvalidRoles
+	}
+	for _, role := range roles {
+		if !slices.Contains(common.KnownRoles, role) {
+			return ErrInvalidRoles
+		}
+	}
+
+	return s.storage.SetRoles(client.context(), userID, roles)
+}
+
+// подтверждение текущим паролем (смена пароля, удаление аккаунта): общий счётчик неудач,
+// чтобы украденный access-токен не давал перебирать пароль в обход блокировки входа
+func (s *Service) verifyCurrentPassword(ctx context.Context, u Auth, password string) error {
+	subject := "user:" + u.ID
+	if err := s.limiter.CheckLockout(ctx, EndpointUpdatePassword, subject); err != nil {
+		return err
+	}
+
+	ok, err := s.checkPassword(u, password)
 	if err != nil {
+		return err
+	}
+	if !ok {
+		if err := s.limiter.RegisterFailure(ctx, EndpointUpdatePassword, subject); err != nil {
+			common.Logf(ctx, "failed to register password failure for %s: %v", u.ID, err)
+		}
 		return ErrInvalidPassword
 	}
 
-	salt, err = generateSalt(16)
+	if err := s.limiter.Reset(ctx, EndpointUpdatePassword, subject); err != nil {
+		common.Logf(ctx, "failed to reset password failures for %s: %v", u.ID, err)
+	}
+	return nil
+}
+
+func (s *Service) UpdatePassword(uuid, newPassword, oldPassword string, client ClientInfo) (err error) {
+	defer func() { s.audit(AuditEntry{Event: AuditPasswordUpdate, UserID: uuid}, client, err) }()
+
+	ctx := client.context()
+	u, err := s.storage.GetCredInfoByUuid(ctx, uuid)
 	if err != nil {
 		return err
 	}
-	combined = newPassword + salt
-	newHashed, err := bcrypt.GenerateFromPassword([]byte(combined), bcrypt.DefaultCost)
+
+	if err := s.verifyCurrentPassword(ctx, u, oldPassword); err != nil {
+		return err
+	}
+
+	newHashed, err := s.hasher.Hash(newPassword)
 	if err != nil {
 		return err
 	}
 
-	err = s.storage.UpdatePasswordForUuid(uuid, string(newHashed), salt)
+	err = s.storage.UpdatePasswordForUuid(ctx, uuid, newHashed)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,136 @@
+package authgateway
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/quizverse3D/Backend/internal/common"
+	"github.com/redis/go-redis/v9"
+)
+
+const maxUserAgentLength = 256
+
+// откуда пришёл запрос на вход или обновление токена
+type ClientInfo struct {
+	IP        string
+	UserAgent string
+	ctx       context.Context // request ID и текущий спан запроса, без отмены
+}
+
+// контекст операции: request ID попадает в логи и события шины, спаны Redis — в трейс запроса
+func (c ClientInfo) context() context.Context {
+	if c.ctx == nil {
+		return context.Background()
+	}
+	return c.ctx
+}
+
+// активная сессия (устройство) пользователя
+type Session struct {
+	ID         string    `json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	Current    bool      `json:"current"`
+}
+
+// session:<userID>:<sessionID> — hash с метаданными сессии, живёт столько же, сколько refresh-токен
+func sessionKey(userID, sessionID string) string {
+	return fmt.Sprintf("session:%s:%s", userID, sessionID)
+}
+
+// время последнего использования и адрес обновляются при каждой ротации refresh-токена
+func touchSession(ctx context.Context, pipe redis.Pipeliner, userID, sessionID string, client ClientInfo) {
+	userAgent := client.UserAgent
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+
+	key := sessionKey(userID, sessionID)
+	pipe.HSet(ctx, key,
+		"last_used_at", time.Now().Unix(),
+		"user_agent", userAgent,
+		"ip", client.IP,
+	)
+	pipe.Expire(ctx, key, refreshTokenTTL)
+}
+
+// активные сессии, последние использованные — первыми; currentSessionID отмечается флагом Current
+func (s *Service) ListSessions(ctx context.Context, userID, currentSessionID string) ([]Session, error) {
+	sessionIDs, err := s.redisClient.SMembers(ctx, sessionsKey(userID)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	metas := make([]*redis.MapStringStringCmd, len(sessionIDs))
+	_, err = s.redisClient.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, sessionID := range sessionIDs {
+			metas[i] = pipe.HGetAll(ctx, sessionKey(userID, sessionID))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := []Session{}
+	var expired []any
+	for i, sessionID := range sessionIDs {
+		meta := metas[i].Val()
+		if len(meta) == 0 {
+			// refresh-токен и метаданные истекли, а множество ещё хранит ID
+			expired = append(expired, sessionID)
+			continue
+		}
+
+		createdAt, err := strconv.ParseInt(meta["created_at"], 10, 64)
+		if err != nil {
+			common.Logf(ctx, "skipping session %s of %s with malformed created_at: %v", sessionID, userID, err)
+			continue
+		}
+		lastUsedAt, err := strconv.ParseInt(meta["last_used_at"], 10, 64)
+		if err != nil {
+			common.Logf(ctx, "skipping session %s of %s with malformed last_used_at: %v", sessionID, userID, err)
+			continue
+		}
+		sessions = append(sessions, Session{
+			ID:         sessionID,
+			CreatedAt:  time.Unix(createdAt, 0).UTC(),
+			LastUsedAt: time.Unix(lastUsedAt, 0).UTC(),
+			UserAgent:  meta["user_agent"],
+			IP:         meta["ip"],
+			Current:    sessionID == currentSessionID,
+		})
+	}
+
+	if len(expired) > 0 {
+		s.redisClient.SRem(ctx, sessionsKey(userID), expired...)
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastUsedAt.After(sessions[j].LastUsedAt)
+	})
+	return sessions, nil
+}
+
+// удалённое завершение сессии: refresh-токен удаляется, выданный access-токен живёт до истечения
+func (s *Service) RevokeSession(userID, sessionID string, client ClientInfo) (err error) {
+	defer func() {
+		s.audit(AuditEntry{Event: AuditSessionRevoke, UserID: userID, Details: "session " + sessionID}, client, err)
+	}()
+
+	ctx := client.context()
+	ok, err := s.redisClient.SIsMember(ctx, sessionsKey(userID), sessionID).Result()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrSessionNotFound
+	}
+
+	return s.revokeSession(ctx, userID, sessionID)
+}
@@ -1,11 +1,20 @@
 package authgateway
 
 import (
+	"cmp"
 	"context"
+	"errors"
+	"slices"
+	"time"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// у гостевых аккаунтов email и пароль не заданы
+const credentialsColumns = "id, COALESCE(email, ''), COALESCE(password, ''), COALESCE(password_salt, ''), verified, is_guest, roles"
+
 type Storage struct {
 	db *pgxpool.Pool
 }
@@ -14,28 +23,42 @@ func NewStorage(pool *pgxpool.Pool) *Storage {
 	return &Storage{db: pool}
 }
 
-func (s *Storage) CreateAuth(u Auth) error {
-	_, err := s.db.Exec(context.Background(),
-		"INSERT INTO credentials (id, email, password, password_salt) VALUES ($1, $2, $3, $4)",
-		u.ID, u.Email, u.Password, u.PasswordSalt,
+// учётные данные и событие о регистрации пишутся в одной транзакции
+func (s *Storage) CreateAuth(ctx context.Context, u Auth, event OutboxMessage) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx,
+		"INSERT INTO credentials (id, email, password) VALUES ($1, $2, $3)",
+		u.ID, normalizeEmail(u.Email), u.Password,
 	)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		// unique_violation: почта уже занята
+		return ErrUserExists
+	}
+	if err != nil {
+		return err
+	}
 
-	if err == nil {
-		// ошибок нет, пользователь создан
-		return nil
+	if err := insertOutbox(ctx, tx, event); err != nil {
+		return err
 	}
 
-	return err
+	return tx.Commit(ctx)
 }
 
-func (s *Storage) GetAuth(email string) (Auth, bool) {
-	row := s.db.QueryRow(context.Background(),
-		"SELECT id, email, password, password_salt FROM credentials WHERE email = $1",
-		email,
+func (s *Storage) GetAuth(ctx context.Context, email string) (Auth, bool) {
+	row := s.db.QueryRow(ctx,
+		"SELECT "+credentialsColumns+" FROM credentials WHERE lower(email) = $1",
+		normalizeEmail(email),
 	)
 
 	var u Auth
-	err := row.Scan(&u.ID, &u.Email, &u.Password, &u.PasswordSalt)
+	err := row.Scan(&u.ID, &u.Email, &u.Password, &u.PasswordSalt, &u.Verified, &u.Guest, &u.Roles)
 	if err != nil {
 		return Auth{}, false
 	}
@@ -43,11 +66,11 @@ func (s *Storage) GetAuth(email string) (Auth, bool) {
 	return u, true
 }
 
-func (s *Storage) GetCredInfoByUuid(uuid string) (Auth, error) {
-	row := s.db.QueryRow(context.Background(), "SELECT id, email, password, password_salt FROM credentials WHERE id = $1", uuid)
+func (s *Storage) GetCredInfoByUuid(ctx context.Context, uuid string) (Auth, error) {
+	row := s.db.QueryRow(ctx, "SELECT "+credentialsColumns+" FROM credentials WHERE id = $1", uuid)
 
 	var u Auth
-	err := row.Scan(&u.ID, &u.Email, &u.Password, &u.PasswordSalt)
+	err := row.Scan(&u.ID, &u.Email, &u.Password, &u.PasswordSalt, &u.Verified, &u.Guest, &u.Roles)
 	if err != nil {
 		return Auth{}, err
 	}
@@ -55,8 +78,9 @@ func (s *Storage) GetCredInfoByUuid(uuid string) (Auth, error) {
 	return u, nil
 }
 
-func (s *Storage) UpdatePasswordForUuid(uuid, password, passwordSalt string) error {
-	_, err := s.db.Exec(context.Background(), "UPDATE credentials SET password = $1, password_salt = $2 WHERE id = $3", password, passwordSalt, uuid)
+// соль входит в PHC-строку, password_salt остаётся только у старых bcrypt-хешей
+func (s *Storage) UpdatePasswordForUuid(ctx context.Context, uuid, password string) error {
+	_, err := s.db.Exec(ctx, "UPDATE credentials SET password = $1, password_salt = NULL WHERE id = $2", password, uuid)
 
 	if err == nil {
 		return nil
@@ -64,3 +88,327 @@ func (s *Storage) UpdatePasswordForUuid(uuid, password, passwordSalt string) err
 
 	return err
 }
+
+// замена хеша при входе; не затирает пароль, если его успели сменить параллельно
+func (s *Storage) ReplacePasswordHash(ctx context.Context, uuid, oldHash, newHash string) error {
+	_, err := s.db.Exec(ctx,
+		"UPDATE credentials SET password = $1, password_salt = NULL WHERE id = $2 AND password = $3",
+		newHash, uuid, oldHash,
+	)
+	return err
+}
+
+func (s *Storage) CreateGuest(ctx context.Context, id string, event OutboxMessage) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, "INSERT INTO credentials (id, is_guest) VALUES ($1, TRUE)", id); err != nil {
+		return err
+	}
+
+	if err := insertOutbox(ctx, tx, event); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// привязка email и пароля к гостевому аккаунту с сохранением UUID
+func (s *Storage) UpgradeGuest(ctx context.Context, u Auth) error {
+	tag, err := s.db.Exec(ctx,
+		"UPDATE credentials SET email = $1, password = $2, is_guest = FALSE WHERE id = $3 AND is_guest",
+		normalizeEmail(u.Email), u.Password, u.ID,
+	)
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		// unique_violation: почта уже занята
+		return ErrUserExists
+	}
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotGuest
+	}
+
+	return nil
+}
+
+// 2FA, коды восстановления и API-ключи удаляются каскадно; событие user_deleted — в той же транзакции
+func (s *Storage) DeleteAuth(ctx context.Context, uuid string, event OutboxMessage) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, "DELETE FROM credentials WHERE id = $1", uuid); err != nil {
+		return err
+	}
+
+	if err := insertOutbox(ctx, tx, event); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (s *Storage) SetRoles(ctx context.Context, uuid string, roles []string) error {
+	tag, err := s.db.Exec(ctx, "UPDATE credentials SET roles = $1 WHERE id = $2", roles, uuid)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+func (s *Storage) SetVerified(ctx context.Context, uuid string) error {
+	_, err := s.db.Exec(ctx, "UPDATE credentials SET verified = TRUE WHERE id = $1", uuid)
+	return err
+}
+
+func (s *Storage) GetMFA(ctx context.Context, userID string) (MFA, bool, error) {
+	row := s.db.QueryRow(ctx, "SELECT user_id, secret, enabled FROM mfa WHERE user_id = $1", userID)
+
+	var m MFA
+	err := row.Scan(&m.UserID, &m.Secret, &m.Enabled)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return MFA{}, false, nil
+	}
+	if err != nil {
+		return MFA{}, false, err
+	}
+
+	return m, true, nil
+}
+
+// новый секрет перезаписывает незавершённую настройку, но не включённую 2FA
+func (s *Storage) SaveMFASecret(ctx context.Context, userID, secret string) error {
+	_, err := s.db.Exec(ctx, `
+		INSERT INTO mfa (user_id, secret, enabled) VALUES ($1, $2, FALSE)
+		ON CONFLICT (user_id) DO UPDATE SET secret = EXCLUDED.secret, created_at = now()
+		WHERE mfa.enabled = FALSE`,
+		userID, secret,
+	)
+	return err
+}
+
+// включение 2FA и замена кодов восстановления в одной транзакции
+func (s *Storage) EnableMFA(ctx context.Context, userID string, recoveryCodeHashes []string) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, "UPDATE mfa SET enabled = TRUE WHERE user_id = $1", userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, "DELETE FROM mfa_recovery_codes WHERE user_id = $1", userID); err != nil {
+		return err
+	}
+	for _, hash := range recoveryCodeHashes {
+		if _, err := tx.Exec(ctx, "INSERT INTO mfa_recovery_codes (user_id, code_hash) VALUES ($1, $2)", userID, hash); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+// true, если код существовал и ещё не был использован
+func (s *Storage) UseRecoveryCode(ctx context.Context, userID, codeHash string) (bool, error) {
+	tag, err := s.db.Exec(ctx,
+		"UPDATE mfa_recovery_codes SET used_at = now() WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL",
+		userID, codeHash,
+	)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+func (s *Storage) DeleteMFA(ctx context.Context, userID string) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, "DELETE FROM mfa_recovery_codes WHERE user_id = $1", userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, "DELETE FROM mfa WHERE user_id = $1", userID); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (s *Storage) CreateAPIKey(ctx context.Context, k APIKey) error {
+	_, err := s.db.Exec(ctx,
+		"INSERT INTO api_keys (id, user_id, name, prefix, key_hash, scopes, created_at, expires_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)",
+		k.ID, k.UserID, k.Name, k.Prefix, k.KeyHash, k.Scopes, k.CreatedAt, k.ExpiresAt)
+	return err
+}
+
+func (s *Storage) ListAPIKeys(ctx context.Context, userID string) ([]APIKey, error) {
+	rows, err := s.db.Query(ctx,
+		"SELECT id, user_id, name, prefix, scopes, created_at, expires_at, last_used_at FROM api_keys WHERE user_id = $1 ORDER BY created_at",
+		userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []APIKey{}
+	for rows.Next() {
+		var k APIKey
+		if err := rows.Scan(&k.ID, &k.UserID, &k.Name, &k.Prefix, &k.Scopes, &k.CreatedAt, &k.ExpiresAt, &k.LastUsedAt); err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+func (s *Storage) GetAPIKeyByHash(ctx context.Context, hash string) (APIKey, bool, error) {
+	row := s.db.QueryRow(ctx,
+		"SELECT id, user_id, name, prefix, scopes, created_at, expires_at, last_used_at FROM api_keys WHERE key_hash = $1",
+		hash)
+
+	var k APIKey
+	err := row.Scan(&k.ID, &k.UserID, &k.Name, &k.Prefix, &k.Scopes, &k.CreatedAt, &k.ExpiresAt, &k.LastUsedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return APIKey{}, false, nil
+	}
+	if err != nil {
+		return APIKey{}, false, err
+	}
+
+	return k, true, nil
+}
+
+// сброс пароля: владелец мог потерять контроль над аккаунтом, поэтому выданные API-ключи удаляются вместе со сменой пароля
+func (s *Storage) ResetPasswordForUuid(ctx context.Context, uuid, password string) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, "UPDATE credentials SET password = $1, password_salt = NULL WHERE id = $2", password, uuid); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, "DELETE FROM api_keys WHERE user_id = $1", uuid); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (s *Storage) TouchAPIKey(ctx context.Context, id string) error {
+	_, err := s.db.Exec(ctx, "UPDATE api_keys SET last_used_at = now() WHERE id = $1", id)
+	return err
+}
+
+func (s *Storage) DeleteAPIKey(ctx context.Context, userID, id string) error {
+	tag, err := s.db.Exec(ctx, "DELETE FROM api_keys WHERE id = $1 AND user_id = $2", id, userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// захват пачки неотправленных событий арендой на lease. Публикация идёт вне транзакции,
+// поэтому строки не держатся заблокированными, пока relay ждёт подтверждения брокера;
+// SKIP LOCKED и аренда позволяют запускать relay в нескольких экземплярах gateway
+func (s *Storage) ClaimOutbox(ctx context.Context, limit int, lease time.Duration) ([]OutboxMessage, error) {
+	rows, err := s.db.Query(ctx, `
+		UPDATE outbox SET locked_until = now() + $2::interval
+		WHERE id IN (
+			SELECT id FROM outbox
+			WHERE sent_at IS NULL AND (locked_until IS NULL OR locked_until < now())
+			ORDER BY id LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, exchange, routing_key, payload, COALESCE(request_id, ''), COALESCE(traceparent, '')`,
+		limit, lease,
+	)
+	if err != nil {
+		return nil, err
+	}
+	messages, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (OutboxMessage, error) {
+		var m OutboxMessage
+		err := row.Scan(&m.ID, &m.Exchange, &m.RoutingKey, &m.Payload, &m.RequestID, &m.TraceParent)
+		return m, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// RETURNING не сохраняет порядок подзапроса
+	slices.SortFunc(messages, func(a, b OutboxMessage) int { return cmp.Compare(a.ID, b.ID) })
+	return messages, nil
+}
+
+func (s *Storage) MarkOutboxSent(ctx context.Context, id int64) error {
+	_, err := s.db.Exec(ctx, "UPDATE outbox SET sent_at = now(), locked_until = NULL WHERE id = $1", id)
+	return err
+}
+
+// снятие аренды с неопубликованных событий: следующий опрос возьмёт их сразу и в прежнем порядке
+func (s *Storage) ReleaseOutbox(ctx context.Context, ids []int64) error {
+	_, err := s.db.Exec(ctx, "UPDATE outbox SET locked_until = NULL WHERE id = ANY($1) AND sent_at IS NULL", ids)
+	return err
+}
+
+// удаление отправленных событий старше retention
+func (s *Storage) PurgeOutbox(ctx context.Context, retention time.Duration) (int64, error) {
+	tag, err := s.db.Exec(ctx, "DELETE FROM outbox WHERE sent_at IS NOT NULL AND sent_at < now() - $1::interval", retention)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+func (s *Storage) InsertAudit(ctx context.Context, e AuditEntry) error {
+	_, err := s.db.Exec(ctx,
+		"INSERT INTO audit_log (event, outcome, user_id, email, ip, user_agent, details) VALUES ($1, $2, NULLIF($3, '')::uuid, NULLIF($4, ''), $5, $6, NULLIF($7, ''))",
+		e.Event, e.Outcome, e.UserID, e.Email, e.IP, e.UserAgent, e.Details,
+	)
+	return err
+}
+
+func (s *Storage) QueryAudit(ctx context.Context, f AuditFilter) ([]AuditEntry, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT id, occurred_at, event, outcome, COALESCE(user_id::text, ''), COALESCE(email, ''), ip, user_agent, COALESCE(details, '')
+		FROM audit_log
+		WHERE ($1 = '' OR user_id = NULLIF($1, '')::uuid)
+		  AND ($2 = '' OR event = $2)
+		  AND ($3::timestamptz IS NULL OR occurred_at >= $3)
+		  AND ($4::timestamptz IS NULL OR occurred_at < $4)
+		  AND ($5::bigint = 0 OR id < $5::bigint)
+		ORDER BY id DESC
+		LIMIT $6`,
+		f.UserID, f.Event, f.From, f.To, f.BeforeID, f.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (AuditEntry, error) {
+		var e AuditEntry
+		err := row.Scan(&e.ID, &e.OccurredAt, &e.Event, &e.Outcome, &e.UserID, &e.Email, &e.IP, &e.UserAgent, &e.Details)
+		return e, err
+	})
+}
@@ -0,0 +1,96 @@
+package authgateway
+
+import (
+	"context"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/quizverse3D/Backend/internal/common"
+	"github.com/redis/go-redis/v9"
+)
+
+const emailVerificationTTL = 24 * time.Hour
+
+// email_verify:<jti> — неиспользованный токен подтверждения почты
+func emailVerifyKey(tokenID string) string {
+	return fmt.Sprintf("email_verify:%s", tokenID)
+}
+
+// почта хранится и ищется в нижнем регистре: Foo@x.com и foo@x.com — один аккаунт,
+// как и в ключах rate limit и lockout
+func normalizeEmail(email string) string {
+	return strings.ToLower(email)
+}
+
+func isValidEmail(email string) bool {
+	addr, err := mail.ParseAddress(email)
+	// отсекаем формы вида "Name <user@host>"
+	return err == nil && addr.Address == email
+}
+
+// ограниченный access-токен выдаётся неподтверждённым аккаунтам при LoginPolicyLimited;
+// гостям подтверждать нечего, их ограничения не касаются
+func (s *Service) isLimited(u Auth) bool {
+	return !u.Guest && !u.Verified && s.cfg.UnverifiedLoginPolicy == LoginPolicyLimited
+}
+
+func (s *Service) sendVerificationEmail(ctx context.Context, userID, email string) error {
+	tokenID := uuid.NewString()
+	token, err := GenerateEmailVerificationToken(userID, tokenID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.redisClient.Set(ctx, emailVerifyKey(tokenID), userID, emailVerificationTTL).Err(); err != nil {
+		return err
+	}
+
+	link := s.cfg.VerifyEmailURL + "?token=" + url.QueryEscape(token)
+	return s.mailer.Send(ctx, common.MailMessage{
+		To:      email,
+		Subject: "Quizverse3D: подтверждение почты",
+		Body:    "Для подтверждения почты перейдите по ссылке:\n" + link + "\n\nСсылка действительна 24 часа.",
+	})
+}
+
+// повторная отправка письма; для неизвестных и уже подтверждённых адресов ничего не делает,
+// чтобы по ответу нельзя было определить наличие аккаунта. Письмо уходит в фоне, как и при сбросе пароля
+func (s *Service) ResendVerificationEmail(email string, client ClientInfo) (err error) {
+	ctx := client.context()
+	u, ok := s.storage.GetAuth(ctx, email)
+	defer func() { s.audit(AuditEntry{Event: AuditVerifyResend, UserID: u.ID, Email: email}, client, err) }()
+	if !ok || u.Verified {
+		return nil
+	}
+
+	go func() {
+		if err := s.sendVerificationEmail(ctx, u.ID, u.Email); err != nil {
+			common.Logf(ctx, "failed to send verification email to %s: %v", u.Email, err)
+		}
+	}()
+	return nil
+}
+
+func (s *Service) VerifyEmail(token string, client ClientInfo) (err error) {
+	userID, tokenID, err := ValidateEmailVerificationToken(token)
+	if err != nil {
+		return err
+	}
+	defer func() { s.audit(AuditEntry{Event: AuditVerifyEmail, UserID: userID}, client, err) }()
+
+	// GETDEL делает токен одноразовым
+	ctx := client.context()
+	storedUserID, err := s.redisClient.GetDel(ctx, emailVerifyKey(tokenID)).Result()
+	if err == redis.Nil || (err == nil && storedUserID != userID) {
+		return ErrInvalidVerificationToken
+	}
+	if err != nil {
+		return err
+	}
+
+	return s.storage.SetVerified(ctx, userID)
+}
@@ -0,0 +1,156 @@
+package common
+
+import (
+	"context"
+	"crypto/sha256"
+	"strings"
+	"sync"
+	"time"
+
+	authPb "github.com/quizverse3D/Backend/internal/pb/auth"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// не даёт кэшу расти без ограничений при потоке разных токенов
+const authClientMaxEntries = 10000
+
+// результат проверки токена в authgateway
+type TokenInfo struct {
+	Active     bool
+	UserID     string
+	Roles      []string
+	SessionID  string
+	ExpiresAt  time.Time // нулевое время — бессрочный API-ключ
+	Unverified bool
+	Scopes     []string
+}
+
+func (t TokenInfo) Caller() Caller {
+	return Caller{UserID: t.UserID, Roles: t.Roles}
+}
+
+type cachedToken struct {
+	info    TokenInfo
+	expires time.Time
+}
+
+// клиент AuthService.Introspect для сервисов, которые проверяют токены сами.
+// Ответы кэшируются на ttl: завершённая сессия может действовать ещё до ttl
+type AuthClient struct {
+	conn   *grpc.ClientConn
+	client authPb.AuthServiceClient
+	ttl    time.Duration
+
+	mu    sync.Mutex
+	cache map[[sha256.Size]byte]cachedToken
+}
+
+func NewAuthClient(target string, ttl time.Duration) (*AuthClient, error) {
+	conn, err := grpc.NewClient(target,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithStatsHandler(otelgrpc.NewClientHandler()),
+		grpc.WithUnaryInterceptor(GRPCClientMetricsInterceptor()),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &AuthClient{
+		conn:   conn,
+		client: authPb.NewAuthServiceClient(conn),
+		ttl:    ttl,
+		cache:  make(map[[sha256.Size]byte]cachedToken),
+	}, nil
+}
+
+func (c *AuthClient) Close() error {
+	return c.conn.Close()
+}
+
+// недействительный токен — не ошибка, а Active == false; ошибки связи не кэшируются
+func (c *AuthClient) Introspect(ctx context.Context, token string) (TokenInfo, error) {
+	// в памяти держим хеш, а не сам токен
+	key := sha256.Sum256([]byte(token))
+	now := time.Now()
+
+	c.mu.Lock()
+	cached, ok := c.cache[key]
+	c.mu.Unlock()
+	if ok && now.Before(cached.expires) {
+		return cached.info, nil
+	}
+
+	resp, err := c.client.Introspect(OutgoingRequestIDContext(ctx), &authPb.IntrospectRequest{Token: token})
+	if err != nil {
+		return TokenInfo{}, err
+	}
+
+	info := TokenInfo{
+		Active:     resp.GetActive(),
+		UserID:     resp.GetUserId(),
+		Roles:      resp.GetRoles(),
+		SessionID:  resp.GetSessionId(),
+		Unverified: resp.GetUnverified(),
+		Scopes:     resp.GetScopes(),
+	}
+	if resp.GetExpiresAt() != nil {
+		info.ExpiresAt = resp.GetExpiresAt().AsTime()
+	}
+
+	// токен не должен пережить в кэше собственный срок действия
+	expires := now.Add(c.ttl)
+	if info.Active && !info.ExpiresAt.IsZero() && info.ExpiresAt.Before(expires) {
+		expires = info.ExpiresAt
+	}
+
+	c.mu.Lock()
+	if len(c.cache) >= authClientMaxEntries {
+		c.evictExpired(now)
+	}
+	if len(c.cache) < authClientMaxEntries {
+		c.cache[key] = cachedToken{info: info, expires: expires}
+	}
+	c.mu.Unlock()
+
+	return info, nil
+}
+
+// вызывается под c.mu
+func (c *AuthClient) evictExpired(now time.Time) {
+	for key, cached := range c.cache {
+		if !now.Before(cached.expires) {
+			delete(c.cache, key)
+		}
+	}
+}
+
+// серверный interceptor: пользователь и роли берутся из проверки токена в authgateway,
+// а не из metadata, которую может подставить любой клиент. Пробы grpc.health.v1 — без токена
+func AuthUnaryInterceptor(client *AuthClient) grpc.UnaryServerInterceptor {
+	healthPrefix := "/" + healthpb.Health_ServiceDesc.ServiceName + "/"
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if strings.HasPrefix(info.FullMethod, healthPrefix) {
+			return handler(ctx, req)
+		}
+
+		token := bearerToken(ctx)
+		if token == "" {
+			return nil, status.Error(codes.Unauthenticated, "missing token")
+		}
+
+		tokenInfo, err := client.Introspect(ctx, token)
+		if err != nil {
+			Logf(ctx, "token introspection failed: %v", err)
+			return nil, status.Error(codes.Unavailable, "token introspection failed")
+		}
+		if !tokenInfo.Active {
+			return nil, status.Error(codes.Unauthenticated, "invalid token")
+		}
+
+		return handler(ContextWithCaller(ctx, tokenInfo.Caller()), req)
+	}
+}
@@ -2,25 +2,155 @@ package common
 
 import (
 	"context"
+	"fmt"
 	"log"
+	"sync"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/streadway/amqp"
+	"go.opentelemetry.io/otel/codes"
 )
 
+var (
+	consumerMessages = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rabbitmq_consumer_messages_total",
+		Help: "Сообщения, подтверждённые обработчиком: result = ack, nack или reject",
+	}, []string{"queue", "result"})
+	consumerHandleDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "rabbitmq_consumer_handle_duration_seconds",
+		Help:    "Время обработки сообщения",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"queue"})
+)
+
+// отставание consumer'а: сообщения, ещё не выданные из очереди. QueueInspect идёт через отдельный
+// короткоживущий канал: ошибка inspect закрывает канал, и на канале consumer'а остановила бы доставку
+type queueDepthCollector struct {
+	queue string
+	desc  *prometheus.Desc
+
+	mu   sync.Mutex
+	conn *amqp.Connection
+}
+
+func (c *queueDepthCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *queueDepthCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	conn := c.conn
+	c.mu.Unlock()
+
+	inspectChannel, err := conn.Channel()
+	if err != nil {
+		return
+	}
+	defer inspectChannel.Close()
+
+	q, err := inspectChannel.QueueInspect(c.queue)
+	if err != nil {
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(q.Messages))
+}
+
+// коллектор регистрируется один раз на очередь; повторный Listen (например, после
+// переподключения) только переключает его на новое соединение
+var (
+	queueDepthMu         sync.Mutex
+	queueDepthCollectors = map[string]*queueDepthCollector{}
+)
+
+func registerQueueDepth(conn *amqp.Connection, queue string) {
+	queueDepthMu.Lock()
+	defer queueDepthMu.Unlock()
+
+	if c, ok := queueDepthCollectors[queue]; ok {
+		c.mu.Lock()
+		c.conn = conn
+		c.mu.Unlock()
+		return
+	}
+
+	c := &queueDepthCollector{
+		queue: queue,
+		conn:  conn,
+		desc: prometheus.NewDesc("rabbitmq_consumer_queue_messages", "Сообщения в очереди, ожидающие обработки",
+			nil, prometheus.Labels{"queue": queue}),
+	}
+	if err := prometheus.Register(c); err != nil {
+		log.Printf("failed to register queue metrics for %s: %v", queue, err)
+		return
+	}
+	queueDepthCollectors[queue] = c
+}
+
+// обработчики сами вызывают msg.Ack/Nack, поэтому результат считается на уровне Acknowledger
+type countingAcknowledger struct {
+	amqp.Acknowledger
+	queue string
+}
+
+func (a countingAcknowledger) Ack(tag uint64, multiple bool) error {
+	consumerMessages.WithLabelValues(a.queue, "ack").Inc()
+	return a.Acknowledger.Ack(tag, multiple)
+}
+
+func (a countingAcknowledger) Nack(tag uint64, multiple, requeue bool) error {
+	consumerMessages.WithLabelValues(a.queue, "nack").Inc()
+	return a.Acknowledger.Nack(tag, multiple, requeue)
+}
+
+func (a countingAcknowledger) Reject(tag uint64, requeue bool) error {
+	consumerMessages.WithLabelValues(a.queue, "reject").Inc()
+	return a.Acknowledger.Reject(tag, requeue)
+}
+
 type Consumer struct {
-	channel *amqp.Channel
-	queue   string
-	handler func(amqp.Delivery)
+	conn     *amqp.Connection // для служебных каналов, например QueueInspect в метриках
+	channel  *amqp.Channel
+	exchange string // fanout-exchange, к которому привязана очередь; пусто — очередь по умолчанию
+	queue    string
+	handler  func(context.Context, amqp.Delivery)
 }
 
-func NewConsumer(channel *amqp.Channel, queue string, handler func(amqp.Delivery)) *Consumer {
+// обработчик получает контекст с request ID из заголовка x-request-id сообщения
+func NewConsumer(conn *amqp.Connection, channel *amqp.Channel, queue string, handler func(context.Context, amqp.Delivery)) *Consumer {
 	return &Consumer{
+		conn:    conn,
 		channel: channel,
 		queue:   queue,
 		handler: handler,
 	}
 }
 
+// consumer собственной очереди сервиса, привязанной к fanout-exchange:
+// каждое событие получают все сервисы-подписчики
+func NewExchangeConsumer(conn *amqp.Connection, channel *amqp.Channel, exchange, queue string, handler func(context.Context, amqp.Delivery)) *Consumer {
+	return &Consumer{
+		conn:     conn,
+		channel:  channel,
+		exchange: exchange,
+		queue:    queue,
+		handler:  handler,
+	}
+}
+
+// fanout-exchange для событий с несколькими подписчиками
+func DeclareFanoutExchange(channel *amqp.Channel, exchange string) error {
+	return channel.ExchangeDeclare(
+		exchange,
+		amqp.ExchangeFanout,
+		true,  // durable
+		false, // autoDelete
+		false, // internal
+		false, // noWait
+		nil,
+	)
+}
+
 func (c *Consumer) DeclareQueue() error {
 	_, err := c.channel.QueueDeclare(
 		c.queue,
@@ -30,7 +160,14 @@ func (c *Consumer) DeclareQueue() error {
 		false,
 		nil,
 	)
-	return err
+	if err != nil || c.exchange == "" {
+		return err
+	}
+
+	if err := DeclareFanoutExchange(c.channel, c.exchange); err != nil {
+		return err
+	}
+	return c.channel.QueueBind(c.queue, "", c.exchange, false, nil)
 }
 
 func (c *Consumer) Listen(ctx context.Context) error {
@@ -47,6 +184,8 @@ func (c *Consumer) Listen(ctx context.Context) error {
 		return err
 	}
 
+	registerQueueDepth(c.conn, c.queue)
+
 	go func() {
 		for {
 			select {
@@ -57,6 +196,7 @@ func (c *Consumer) Listen(ctx context.Context) error {
 			case msg, ok := <-msgs:
 				if !ok {
 					log.Printf("channel closed for queue %s", c.queue)
+					return
 				}
 				c.safeHandle(msg)
 			}
@@ -67,13 +207,23 @@ func (c *Consumer) Listen(ctx context.Context) error {
 }
 
 func (c *Consumer) safeHandle(msg amqp.Delivery) {
+	ctx := ContextWithRequestID(context.Background(), RequestIDFromDelivery(msg))
+	ctx, span := startConsumeSpan(ctx, c.queue, msg)
+	defer span.End()
+
+	if msg.Acknowledger != nil {
+		msg.Acknowledger = countingAcknowledger{Acknowledger: msg.Acknowledger, queue: c.queue}
+	}
+	timer := prometheus.NewTimer(consumerHandleDuration.WithLabelValues(c.queue))
+	defer timer.ObserveDuration()
 	defer func() {
 		if r := recover(); r != nil {
 			// отлов исключения и продолжение выполнения в случае panic()
-			log.Printf("recovered in consumer for queue %s: %v", c.queue, r)
+			Logf(ctx, "recovered in consumer for queue %s: %v", c.queue, r)
+			span.SetStatus(codes.Error, fmt.Sprint(r))
 			msg.Nack(false, true) // retry
 		}
 	}()
 
-	c.handler(msg)
+	c.handler(ctx, msg)
 }
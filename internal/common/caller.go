@@ -0,0 +1,84 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// роли пользователей, хранятся в credentials и попадают в access-токен
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+var KnownRoles = []string{RoleUser, RoleModerator, RoleAdmin}
+
+// gateway передаёт сервисам исходный заголовок Authorization (JWT или API-ключ)
+const MetadataAuthorization = "authorization"
+
+// пользователь, от имени которого gateway вызывает gRPC-метод
+type Caller struct {
+	UserID string
+	Roles  []string
+}
+
+func (c Caller) HasRole(roles ...string) bool {
+	for _, role := range roles {
+		if slices.Contains(c.Roles, role) {
+			return true
+		}
+	}
+	return false
+}
+
+type callerKey struct{}
+
+func ContextWithCaller(ctx context.Context, caller Caller) context.Context {
+	return context.WithValue(ctx, callerKey{}, caller)
+}
+
+func CallerFromContext(ctx context.Context) (Caller, bool) {
+	caller, ok := ctx.Value(callerKey{}).(Caller)
+	return caller, ok
+}
+
+// user_uuid из запроса не совпадает с пользователем из токена
+var ErrCallerMismatch = errors.New("user_uuid does not match the authenticated user")
+
+// ID пользователя, от имени которого выполняется вызов, берётся из проверенного токена, а не из запроса;
+// user_uuid из запроса, если задан, должен с ним совпадать
+func CallerUserID(ctx context.Context, requested string) (string, error) {
+	caller, ok := CallerFromContext(ctx)
+	if !ok || caller.UserID == "" {
+		return "", status.Error(codes.Unauthenticated, "missing caller")
+	}
+	if requested != "" && requested != caller.UserID {
+		return "", ErrCallerMismatch
+	}
+	return caller.UserID, nil
+}
+
+// исходящие metadata для вызова gRPC-сервиса от имени пользователя;
+// сервис сам проверяет токен через AuthUnaryInterceptor
+func OutgoingAuthorizationContext(ctx context.Context, authorization string) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, MetadataAuthorization, authorization)
+}
+
+func bearerToken(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	values := md.Get(MetadataAuthorization)
+	if len(values) == 0 {
+		return ""
+	}
+	return strings.TrimPrefix(values[0], "Bearer ")
+}
@@ -0,0 +1,51 @@
+package common
+
+import (
+	"context"
+	"errors"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// доменная ошибка сервиса → gRPC-код и стабильный машинно-читаемый код (ErrorInfo.Reason)
+type ErrorStatus struct {
+	Err    error
+	Code   codes.Code
+	Reason string
+}
+
+// gRPC-ошибка с ErrorInfo{Reason, Domain}; gateway отдаёт Reason клиенту как код ошибки
+func StatusError(code codes.Code, reason, domain, message string) error {
+	st := status.New(code, message)
+	if detailed, err := st.WithDetails(&errdetails.ErrorInfo{Reason: reason, Domain: domain}); err == nil {
+		st = detailed
+	}
+	return st.Err()
+}
+
+// серверный interceptor: доменные ошибки из statuses превращаются в status.Error с нужным кодом,
+// остальные — в Internal без подробностей, чтобы текст ошибок БД не уходил клиенту
+func ErrorStatusUnaryInterceptor(domain string, statuses []ErrorStatus) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		resp, err := handler(ctx, req)
+		if err == nil {
+			return resp, nil
+		}
+
+		if _, ok := status.FromError(err); ok {
+			return resp, err
+		}
+		for _, s := range statuses {
+			if errors.Is(err, s.Err) {
+				return nil, StatusError(s.Code, s.Reason, domain, s.Err.Error())
+			}
+		}
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			return nil, status.FromContextError(err).Err()
+		}
+		return nil, StatusError(codes.Internal, "INTERNAL", domain, "internal error")
+	}
+}
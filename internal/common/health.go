@@ -0,0 +1,184 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/redis/go-redis/v9"
+	"github.com/streadway/amqp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+const (
+	HealthCheckInterval = 5 * time.Second
+	healthCheckTimeout  = 2 * time.Second
+)
+
+// проверка одной зависимости сервиса; ошибка — сервис не готов принимать запросы
+type HealthCheck struct {
+	Name  string
+	Check func(ctx context.Context) error
+}
+
+func PostgresHealthCheck(pool *pgxpool.Pool) HealthCheck {
+	return HealthCheck{Name: "postgres", Check: pool.Ping}
+}
+
+func RedisHealthCheck(client *redis.Client) HealthCheck {
+	return HealthCheck{Name: "redis", Check: func(ctx context.Context) error {
+		return client.Ping(ctx).Err()
+	}}
+}
+
+func RabbitMQHealthCheck(conn *amqp.Connection) HealthCheck {
+	return HealthCheck{Name: "rabbitmq", Check: func(context.Context) error {
+		if conn.IsClosed() {
+			return errors.New("connection closed")
+		}
+		return nil
+	}}
+}
+
+// downstream gRPC-сервис отвечает на grpc.health.v1 статусом SERVING
+func GRPCHealthCheck(name string, conn *grpc.ClientConn) HealthCheck {
+	client := healthpb.NewHealthClient(conn)
+	return HealthCheck{Name: name, Check: func(ctx context.Context) error {
+		resp, err := client.Check(ctx, &healthpb.HealthCheckRequest{})
+		if err != nil {
+			return err
+		}
+		if resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+			return fmt.Errorf("status %s", resp.GetStatus())
+		}
+		return nil
+	}}
+}
+
+// периодически проверяет зависимости; пробы читают последний результат, а не ходят в БД сами
+type HealthChecker struct {
+	checks []HealthCheck
+
+	mu       sync.RWMutex
+	checked  bool
+	failures map[string]string
+	onChange []func(ready bool)
+}
+
+func NewHealthChecker(checks ...HealthCheck) *HealthChecker {
+	return &HealthChecker{checks: checks}
+}
+
+// вызывается после первой проверки и при каждой смене готовности
+func (h *HealthChecker) OnChange(f func(ready bool)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.onChange = append(h.onChange, f)
+}
+
+func (h *HealthChecker) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		h.checkAll(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (h *HealthChecker) checkAll(ctx context.Context) {
+	failures := make(map[string]string)
+	for _, c := range h.checks {
+		checkCtx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+		if err := c.Check(checkCtx); err != nil {
+			failures[c.Name] = err.Error()
+		}
+		cancel()
+	}
+
+	h.mu.Lock()
+	wasReady := h.checked && len(h.failures) == 0
+	first := !h.checked
+	h.checked = true
+	h.failures = failures
+	ready := len(failures) == 0
+	listeners := h.onChange
+	h.mu.Unlock()
+
+	if first || ready != wasReady {
+		if ready {
+			log.Println("health: all dependencies are available")
+		} else {
+			log.Printf("health: not ready: %v", failures)
+		}
+		for _, f := range listeners {
+			f(ready)
+		}
+	}
+}
+
+// до первой проверки сервис считается неготовым
+func (h *HealthChecker) Status() (ready bool, failures map[string]string) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.checked && len(h.failures) == 0, h.failures
+}
+
+// liveness: процесс жив и обрабатывает HTTP, зависимости не проверяются
+func LivenessHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// readiness: 503 со списком недоступных зависимостей
+func (h *HealthChecker) ReadinessHandler(w http.ResponseWriter, r *http.Request) {
+	ready, failures := h.Status()
+
+	checks := make(map[string]string, len(h.checks))
+	for _, c := range h.checks {
+		checks[c.Name] = "ok"
+		if failure, ok := failures[c.Name]; ok {
+			checks[c.Name] = failure
+		}
+	}
+
+	status, httpStatus := "ready", http.StatusOK
+	if !ready {
+		status, httpStatus = "not ready", http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(httpStatus)
+	json.NewEncoder(w).Encode(map[string]any{"status": status, "checks": checks})
+}
+
+// grpc.health.v1 на gRPC-сервере: общий статус ("") и статусы serviceNames следуют за HealthChecker
+func RegisterGRPCHealth(server *grpc.Server, checker *HealthChecker, serviceNames ...string) {
+	healthServer := health.NewServer()
+	services := append([]string{""}, serviceNames...)
+	for _, name := range services {
+		healthServer.SetServingStatus(name, healthpb.HealthCheckResponse_NOT_SERVING)
+	}
+	healthpb.RegisterHealthServer(server, healthServer)
+
+	checker.OnChange(func(ready bool) {
+		status := healthpb.HealthCheckResponse_NOT_SERVING
+		if ready {
+			status = healthpb.HealthCheckResponse_SERVING
+		}
+		for _, name := range services {
+			healthServer.SetServingStatus(name, status)
+		}
+	})
+}
@@ -0,0 +1,110 @@
+package common
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMemoryMailer(t *testing.T) {
+	tests := []struct {
+		name string
+		send []MailMessage
+	}{
+		{"no messages", nil},
+		{"one message", []MailMessage{{To: "a@example.com", Subject: "s", Body: "b"}}},
+		{"keeps order", []MailMessage{
+			{To: "a@example.com", Subject: "first"},
+			{To: "b@example.com", Subject: "second"},
+			{To: "a@example.com", Subject: "third"},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewMemoryMailer()
+			for _, msg := range tt.send {
+				if err := m.Send(context.Background(), msg); err != nil {
+					t.Fatalf("Send: %v", err)
+				}
+			}
+
+			got := m.Messages()
+			if len(got) != len(tt.send) || (len(got) > 0 && !reflect.DeepEqual(got, tt.send)) {
+				t.Fatalf("Messages = %v, want %v", got, tt.send)
+			}
+
+			// Messages возвращает копию
+			if len(got) > 0 {
+				got[0].To = "changed@example.com"
+				if m.Messages()[0].To == "changed@example.com" {
+					t.Error("Messages returned internal slice")
+				}
+			}
+		})
+	}
+}
+
+func TestNewMailerFromEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		driver  string
+		want    Mailer
+		wantErr bool
+	}{
+		{"memory", "memory", &MemoryMailer{}, false},
+		{"file", "file", &FileMailer{}, false},
+		{"default is file", "", &FileMailer{}, false},
+		{"smtp", "smtp", &SMTPMailer{}, false},
+		{"unknown", "pigeon", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("MAIL_DRIVER", tt.driver)
+			t.Setenv("MAIL_DIR", t.TempDir())
+
+			got, err := NewMailerFromEnv()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("NewMailerFromEnv = %T, want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewMailerFromEnv: %v", err)
+			}
+			if reflect.TypeOf(got) != reflect.TypeOf(tt.want) {
+				t.Errorf("NewMailerFromEnv = %T, want %T", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFileMailer(t *testing.T) {
+	dir := t.TempDir()
+	m, err := NewFileMailer(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Send(context.Background(), MailMessage{To: "user@example.com", Subject: "subj", Body: "body"}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*_user_at_example.com.eml"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("mail files = %v (%v), want 1", files, err)
+	}
+	content, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"To: user@example.com\n", "Subject: subj\n", "\n\nbody\n"} {
+		if !strings.Contains(string(content), want) {
+			t.Errorf("mail file %q does not contain %q", content, want)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package common
+
+import (
+	"log"
+	"net/http"
+	"sync"
+
+	grpcprom "github.com/grpc-ecosystem/go-grpc-middleware/providers/prometheus"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/grpc"
+)
+
+// /metrics на отдельном порту: наружу через gateway метрики не публикуются.
+// Пустой порт — метрики не отдаются
+func ServeMetrics(port string) {
+	if port == "" {
+		log.Println("metrics port is not set, /metrics disabled")
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	go func() {
+		log.Println("Metrics running on " + port)
+		if err := http.ListenAndServe(":"+port, mux); err != nil {
+			log.Fatalf("failed to serve metrics: %v", err)
+		}
+	}()
+}
+
+// метрики gRPC-сервера (grpc_server_handled_total, grpc_server_handling_seconds);
+// после регистрации сервисов нужно вызвать InitializeMetrics(grpcServer)
+func NewGRPCServerMetrics() *grpcprom.ServerMetrics {
+	metrics := grpcprom.NewServerMetrics(grpcprom.WithServerHandlingTimeHistogram())
+	prometheus.MustRegister(metrics)
+	return metrics
+}
+
+// одни метрики клиента на процесс: gateway держит несколько соединений
+var grpcClientMetrics = sync.OnceValue(func() *grpcprom.ClientMetrics {
+	metrics := grpcprom.NewClientMetrics(grpcprom.WithClientHandlingTimeHistogram())
+	prometheus.MustRegister(metrics)
+	return metrics
+})
+
+func GRPCClientMetricsInterceptor() grpc.UnaryClientInterceptor {
+	return grpcClientMetrics().UnaryClientInterceptor()
+}
+
+// статистика пула pgxpool на момент опроса
+type pgxPoolCollector struct {
+	pool *pgxpool.Pool
+
+	acquiredConns   *prometheus.Desc
+	idleConns       *prometheus.Desc
+	totalConns      *prometheus.Desc
+	maxConns        *prometheus.Desc
+	acquireCount    *prometheus.Desc
+	acquireDuration *prometheus.Desc
+	emptyAcquire    *prometheus.Desc
+	canceledAcquire *prometheus.Desc
+}
+
+func newPgxPoolCollector(pool *pgxpool.Pool, database string) *pgxPoolCollector {
+	labels := prometheus.Labels{"database": database}
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc("pgxpool_"+name, help, nil, labels)
+	}
+	return &pgxPoolCollector{
+		pool:            pool,
+		acquiredConns:   desc("acquired_conns", "Соединения, выданные из пула"),
+		idleConns:       desc("idle_conns", "Свободные соединения"),
+		totalConns:      desc("total_conns", "Все соединения пула"),
+		maxConns:        desc("max_conns", "Максимальный размер пула"),
+		acquireCount:    desc("acquires_total", "Успешные получения соединения"),
+		acquireDuration: desc("acquire_duration_seconds_total", "Суммарное время ожидания соединения"),
+		emptyAcquire:    desc("empty_acquires_total", "Получения соединения, которым пришлось ждать"),
+		canceledAcquire: desc("canceled_acquires_total", "Получения соединения, отменённые контекстом"),
+	}
+}
+
+func (c *pgxPoolCollector) Describe(ch chan<- *prometheus.Desc) {
+	prometheus.DescribeByCollect(c, ch)
+}
+
+func (c *pgxPoolCollector) Collect(ch chan<- prometheus.Metric) {
+	stat := c.pool.Stat()
+	ch <- prometheus.MustNewConstMetric(c.acquiredConns, prometheus.GaugeValue, float64(stat.AcquiredConns()))
+	ch <- prometheus.MustNewConstMetric(c.idleConns, prometheus.GaugeValue, float64(stat.IdleConns()))
+	ch <- prometheus.MustNewConstMetric(c.totalConns, prometheus.GaugeValue, float64(stat.TotalConns()))
+	ch <- prometheus.MustNewConstMetric(c.maxConns, prometheus.GaugeValue, float64(stat.MaxConns()))
+	ch <- prometheus.MustNewConstMetric(c.acquireCount, prometheus.CounterValue, float64(stat.AcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.acquireDuration, prometheus.CounterValue, stat.AcquireDuration().Seconds())
+	ch <- prometheus.MustNewConstMetric(c.emptyAcquire, prometheus.CounterValue, float64(stat.EmptyAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.canceledAcquire, prometheus.CounterValue, float64(stat.CanceledAcquireCount()))
+}
+
+// статистика пула соединений go-redis на момент опроса
+type redisPoolCollector struct {
+	client *redis.Client
+
+	hits       *prometheus.Desc
+	misses     *prometheus.Desc
+	timeouts   *prometheus.Desc
+	totalConns *prometheus.Desc
+	idleConns  *prometheus.Desc
+	staleConns *prometheus.Desc
+}
+
+func newRedisPoolCollector(client *redis.Client) *redisPoolCollector {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc("redis_pool_"+name, help, nil, nil)
+	}
+	return &redisPoolCollector{
+		client:     client,
+		hits:       desc("hits_total", "Свободное соединение нашлось в пуле"),
+		misses:     desc("misses_total", "Свободного соединения не было, открыто новое"),
+		timeouts:   desc("timeouts_total", "Таймауты ожидания соединения"),
+		totalConns: desc("total_conns", "Все соединения пула"),
+		idleConns:  desc("idle_conns", "Свободные соединения"),
+		staleConns: desc("stale_conns_total", "Соединения, закрытые как устаревшие"),
+	}
+}
+
+func (c *redisPoolCollector) Describe(ch chan<- *prometheus.Desc) {
+	prometheus.DescribeByCollect(c, ch)
+}
+
+func (c *redisPoolCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.client.PoolStats()
+	ch <- prometheus.MustNewConstMetric(c.hits, prometheus.CounterValue, float64(stats.Hits))
+	ch <- prometheus.MustNewConstMetric(c.misses, prometheus.CounterValue, float64(stats.Misses))
+	ch <- prometheus.MustNewConstMetric(c.timeouts, prometheus.CounterValue, float64(stats.Timeouts))
+	ch <- prometheus.MustNewConstMetric(c.totalConns, prometheus.GaugeValue, float64(stats.TotalConns))
+	ch <- prometheus.MustNewConstMetric(c.idleConns, prometheus.GaugeValue, float64(stats.IdleConns))
+	ch <- prometheus.MustNewConstMetric(c.staleConns, prometheus.CounterValue, float64(stats.StaleConns))
+}
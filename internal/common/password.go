@@ -0,0 +1,144 @@
+package common
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var ErrUnknownPasswordHash = errors.New("unknown password hash format")
+
+// параметры argon2id; Memory в КиБ
+type PasswordParams struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// рекомендации OWASP для argon2id
+func DefaultPasswordParams() PasswordParams {
+	return PasswordParams{
+		Memory:      64 * 1024,
+		Iterations:  3,
+		Parallelism: 2,
+		SaltLength:  16,
+		KeyLength:   32,
+	}
+}
+
+// ARGON2_MEMORY_KIB, ARGON2_ITERATIONS, ARGON2_PARALLELISM переопределяют значения по умолчанию
+func PasswordParamsFromEnv() (PasswordParams, error) {
+	params := DefaultPasswordParams()
+	for env, target := range map[string]*uint32{
+		"ARGON2_MEMORY_KIB": &params.Memory,
+		"ARGON2_ITERATIONS": &params.Iterations,
+	} {
+		if raw := os.Getenv(env); raw != "" {
+			v, err := strconv.ParseUint(raw, 10, 32)
+			if err != nil || v == 0 {
+				return PasswordParams{}, fmt.Errorf("invalid %s %q", env, raw)
+			}
+			*target = uint32(v)
+		}
+	}
+	if raw := os.Getenv("ARGON2_PARALLELISM"); raw != "" {
+		v, err := strconv.ParseUint(raw, 10, 8)
+		if err != nil || v == 0 {
+			return PasswordParams{}, fmt.Errorf("invalid ARGON2_PARALLELISM %q", raw)
+		}
+		params.Parallelism = uint8(v)
+	}
+	return params, nil
+}
+
+// хеширование паролей в формате PHC: $argon2id$v=19$m=65536,t=3,p=2$<соль>$<хеш>.
+// Соль хранится внутри строки, отдельная колонка с солью нужна только старым bcrypt-хешам
+type PasswordHasher struct {
+	params PasswordParams
+}
+
+func NewPasswordHasher(params PasswordParams) *PasswordHasher {
+	return &PasswordHasher{params: params}
+}
+
+func (h *PasswordHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.params.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, h.params.Iterations, h.params.Memory, h.params.Parallelism, h.params.KeyLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, h.params.Memory, h.params.Iterations, h.params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// проверка пароля; needsRehash — хеш устарел (bcrypt или другие параметры argon2id)
+// и его стоит заменить на Hash(password). legacySalt добавлялся к паролю в bcrypt-хешах
+func (h *PasswordHasher) Verify(password, encoded, legacySalt string) (ok bool, needsRehash bool, err error) {
+	switch {
+	case strings.HasPrefix(encoded, "$argon2id$"):
+		return h.verifyArgon2id(password, encoded)
+
+	case strings.HasPrefix(encoded, "$2a$"), strings.HasPrefix(encoded, "$2b$"), strings.HasPrefix(encoded, "$2y$"):
+		err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password+legacySalt))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, false, nil
+		}
+		if err != nil {
+			return false, false, err
+		}
+		return true, true, nil
+
+	default:
+		return false, false, ErrUnknownPasswordHash
+	}
+}
+
+func (h *PasswordHasher) verifyArgon2id(password, encoded string) (bool, bool, error) {
+	// "", "argon2id", "v=19", "m=...,t=...,p=...", соль, хеш
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 {
+		return false, false, ErrUnknownPasswordHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false, false, ErrUnknownPasswordHash
+	}
+
+	var params PasswordParams
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return false, false, ErrUnknownPasswordHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, false, ErrUnknownPasswordHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return false, false, ErrUnknownPasswordHash
+	}
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+
+	actual := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+	if subtle.ConstantTimeCompare(actual, key) != 1 {
+		return false, false, nil
+	}
+
+	return true, params != h.params, nil
+}
@@ -5,7 +5,11 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 func NewPostgresPool(user string, password string, host string, port string, name string) (*pgxpool.Pool, error) {
@@ -23,8 +27,15 @@ func NewPostgresPool(user string, password string, host string, port string, nam
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel() // обязательно вызвать, чтобы освободить ресурсы
 
+	config, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		return nil, err
+	}
+	// каждый запрос — отдельный спан
+	config.ConnConfig.Tracer = queryTracer{}
+
 	// Инициализируем пул соединений
-	pool, err := pgxpool.New(ctx, dsn)
+	pool, err := pgxpool.NewWithConfig(ctx, config)
 	if err != nil {
 		return nil, err
 	}
@@ -35,5 +46,29 @@ func NewPostgresPool(user string, password string, host string, port string, nam
 		return nil, err
 	}
 
+	if err := prometheus.Register(newPgxPoolCollector(pool, name)); err != nil {
+		return nil, err
+	}
+
 	return pool, nil
 }
+
+type queryTracer struct{}
+
+func (queryTracer) TraceQueryStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	ctx, _ = tracer().Start(ctx, "postgres query",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", "postgresql"),
+			attribute.String("db.name", conn.Config().Database),
+			attribute.String("db.statement", data.SQL),
+		),
+	)
+	return ctx
+}
+
+func (queryTracer) TraceQueryEnd(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryEndData) {
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(attribute.Int64("db.rows_affected", data.CommandTag.RowsAffected()))
+	EndSpan(span, data.Err)
+}
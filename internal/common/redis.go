@@ -6,6 +6,8 @@ import (
 	"os"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/redis/go-redis/extra/redisotel/v9"
 	"github.com/redis/go-redis/v9"
 )
 
@@ -22,6 +24,9 @@ func NewRedisClient() (*redis.Client, error) {
 	}
 
 	client := redis.NewClient(opt)
+	if err := redisotel.InstrumentTracing(client); err != nil {
+		return nil, err
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -31,5 +36,9 @@ func NewRedisClient() (*redis.Client, error) {
 		return nil, err
 	}
 
+	if err := prometheus.Register(newRedisPoolCollector(client)); err != nil {
+		return nil, err
+	}
+
 	return client, nil
 }
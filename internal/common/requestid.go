@@ -0,0 +1,115 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/google/uuid"
+	"github.com/streadway/amqp"
+	"go.opentelemetry.io/otel"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// идентификатор запроса: HTTP-заголовок gateway, ключ gRPC metadata и заголовок AMQP-сообщения
+const (
+	RequestIDHeader   = "X-Request-ID"
+	MetadataRequestID = "x-request-id"
+	AMQPRequestID     = "x-request-id"
+)
+
+const maxRequestIDLength = 128
+
+type requestIDKey struct{}
+
+func NewRequestID() string {
+	return uuid.NewString()
+}
+
+// чужой идентификатор попадает в логи, поэтому допускаются только короткие строки из безопасных символов
+func IsValidRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func ContextWithRequestID(ctx context.Context, requestID string) context.Context {
+	if requestID == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+func RequestIDFromContext(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
+
+// log.Printf с request_id из контекста в начале строки
+func Logf(ctx context.Context, format string, args ...any) {
+	message := fmt.Sprintf(format, args...)
+	if requestID := RequestIDFromContext(ctx); requestID != "" {
+		message = "request_id=" + requestID + " " + message
+	}
+	log.Output(2, message)
+}
+
+// исходящие metadata с request ID для вызова другого gRPC-сервиса
+func OutgoingRequestIDContext(ctx context.Context) context.Context {
+	requestID := RequestIDFromContext(ctx)
+	if requestID == "" {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, MetadataRequestID, requestID)
+}
+
+// серверный interceptor: request ID из metadata (или новый, если вызов пришёл не через gateway)
+// попадает в контекст обработчика и в заголовок ответа
+func RequestIDUnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		var requestID string
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			if ids := md.Get(MetadataRequestID); len(ids) > 0 {
+				requestID = ids[0]
+			}
+		}
+		if !IsValidRequestID(requestID) {
+			requestID = NewRequestID()
+		}
+		grpc.SetHeader(ctx, metadata.Pairs(MetadataRequestID, requestID))
+
+		return handler(ContextWithRequestID(ctx, requestID), req)
+	}
+}
+
+// заголовки AMQP-сообщения с request ID и trace context; nil, если в контексте нет ни того, ни другого
+func AMQPHeaders(ctx context.Context) amqp.Table {
+	headers := amqp.Table{}
+	if requestID := RequestIDFromContext(ctx); requestID != "" {
+		headers[AMQPRequestID] = requestID
+	}
+	otel.GetTextMapPropagator().Inject(ctx, amqpHeadersCarrier(headers))
+	if len(headers) == 0 {
+		return nil
+	}
+	return headers
+}
+
+// пусто, если заголовка нет или он не похож на request ID
+func RequestIDFromDelivery(msg amqp.Delivery) string {
+	requestID, _ := msg.Headers[AMQPRequestID].(string)
+	if !IsValidRequestID(requestID) {
+		return ""
+	}
+	return requestID
+}
@@ -0,0 +1,58 @@
+package common
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/streadway/amqp"
+)
+
+func TestIsValidRequestID(t *testing.T) {
+	tests := []struct {
+		name string
+		id   string
+		want bool
+	}{
+		{"uuid", "3f1c8a52-6f0e-4d8e-9a51-2b8e2c1d0f7a", true},
+		{"allowed punctuation", "req_1.2:3-4", true},
+		{"single character", "a", true},
+		{"max length", strings.Repeat("a", maxRequestIDLength), true},
+		{"empty", "", false},
+		{"too long", strings.Repeat("a", maxRequestIDLength+1), false},
+		{"space", "req 1", false},
+		{"newline", "req\nrequest_id=forged", false},
+		{"equals sign", "a=b", false},
+		{"slash", "a/b", false},
+		{"non-ascii letter", "запрос", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsValidRequestID(tt.id); got != tt.want {
+				t.Errorf("IsValidRequestID(%q) = %v, want %v", tt.id, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequestIDFromDelivery(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers amqp.Table
+		want    string
+	}{
+		{"valid", amqp.Table{AMQPRequestID: "req-1"}, "req-1"},
+		{"missing", amqp.Table{}, ""},
+		{"nil headers", nil, ""},
+		{"not a string", amqp.Table{AMQPRequestID: int32(1)}, ""},
+		{"invalid", amqp.Table{AMQPRequestID: "req 1\nforged"}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RequestIDFromDelivery(amqp.Delivery{Headers: tt.headers}); got != tt.want {
+				t.Errorf("RequestIDFromDelivery = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/streadway/amqp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/quizverse3D/Backend"
+
+func tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
+
+// глобальный TracerProvider сервиса. Экспортёр выбирается OTEL_TRACES_EXPORTER:
+// otlp — OTLP/gRPC (адрес в OTEL_EXPORTER_OTLP_ENDPOINT), none или пусто — трейсы не отправляются,
+// но trace context всё равно передаётся дальше по gRPC и RabbitMQ
+func InitTracing(serviceName string) (shutdown func(context.Context) error, err error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exporter sdktrace.SpanExporter
+	switch os.Getenv("OTEL_TRACES_EXPORTER") {
+	case "", "none":
+		return func(context.Context) error { return nil }, nil
+	case "otlp":
+		exporter, err = otlptracegrpc.New(context.Background())
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown OTEL_TRACES_EXPORTER %q", os.Getenv("OTEL_TRACES_EXPORTER"))
+	}
+
+	res, err := resource.New(context.Background(),
+		resource.WithAttributes(attribute.String("service.name", serviceName)),
+		resource.WithFromEnv(), // OTEL_SERVICE_NAME и OTEL_RESOURCE_ATTRIBUTES
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// ошибка операции отмечается в спане
+func EndSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// заголовки AMQP-сообщения как носитель trace context
+type amqpHeadersCarrier amqp.Table
+
+func (c amqpHeadersCarrier) Get(key string) string {
+	value, _ := c[key].(string)
+	return value
+}
+
+func (c amqpHeadersCarrier) Set(key, value string) {
+	c[key] = value
+}
+
+func (c amqpHeadersCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// спан отправки события; контекст спана уходит в заголовки сообщения через AMQPHeaders
+func StartPublishSpan(ctx context.Context, exchange, routingKey string) (context.Context, trace.Span) {
+	destination := exchange
+	if destination == "" {
+		destination = routingKey
+	}
+	return tracer().Start(ctx, destination+" publish",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			attribute.String("messaging.system", "rabbitmq"),
+			attribute.String("messaging.destination.name", exchange),
+			attribute.String("messaging.rabbitmq.destination.routing_key", routingKey),
+		),
+	)
+}
+
+// спан обработки события, дочерний к спану отправителя из заголовков сообщения
+func startConsumeSpan(ctx context.Context, queue string, msg amqp.Delivery) (context.Context, trace.Span) {
+	ctx = otel.GetTextMapPropagator().Extract(ctx, amqpHeadersCarrier(msg.Headers))
+	return tracer().Start(ctx, queue+" process",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			attribute.String("messaging.system", "rabbitmq"),
+			attribute.String("messaging.destination.name", msg.Exchange),
+			attribute.String("messaging.rabbitmq.destination.routing_key", msg.RoutingKey),
+		),
+	)
+}
+
+// traceparent текущего спана для сохранения вместе с отложенным событием (outbox)
+func TraceParent(ctx context.Context) string {
+	carrier := propagation.MapCarrier{}
+	propagation.TraceContext{}.Inject(ctx, carrier)
+	return carrier.Get("traceparent")
+}
+
+func ContextWithTraceParent(ctx context.Context, traceParent string) context.Context {
+	if traceParent == "" {
+		return ctx
+	}
+	return propagation.TraceContext{}.Extract(ctx, propagation.MapCarrier{"traceparent": traceParent})
+}
@@ -1,6 +1,11 @@
 package room
 
-import "errors"
+import (
+	"errors"
+
+	"github.com/quizverse3D/Backend/internal/common"
+	"google.golang.org/grpc/codes"
+)
 
 var (
 	ErrEmptyRoomName     = errors.New("empty room name is not allowed")
@@ -8,4 +13,18 @@ var (
 	ErrInvalidIsPublic   = errors.New("public visibility parameter must be True or False")
 	ErrRoomNotFound      = errors.New("room not found")
 	ErrRoomForbidden     = errors.New("room belongs to another user")
+	ErrInvalidRoomID     = errors.New("room id must be a valid uuid")
+	ErrInvalidUserUuid   = errors.New("user_uuid must be a valid uuid")
 )
+
+// gRPC-коды доменных ошибок; Reason — стабильный код ошибки для клиентов REST API
+var ErrorStatuses = []common.ErrorStatus{
+	{Err: ErrEmptyRoomName, Code: codes.InvalidArgument, Reason: "EMPTY_ROOM_NAME"},
+	{Err: ErrInvalidMaxPlayers, Code: codes.InvalidArgument, Reason: "INVALID_MAX_PLAYERS"},
+	{Err: ErrInvalidIsPublic, Code: codes.InvalidArgument, Reason: "INVALID_IS_PUBLIC"},
+	{Err: ErrRoomNotFound, Code: codes.NotFound, Reason: "ROOM_NOT_FOUND"},
+	{Err: ErrRoomForbidden, Code: codes.PermissionDenied, Reason: "ROOM_FORBIDDEN"},
+	{Err: ErrInvalidRoomID, Code: codes.InvalidArgument, Reason: "INVALID_ROOM_ID"},
+	{Err: ErrInvalidUserUuid, Code: codes.InvalidArgument, Reason: "INVALID_USER_UUID"},
+	{Err: common.ErrCallerMismatch, Code: codes.PermissionDenied, Reason: "USER_UUID_MISMATCH"},
+}
@@ -0,0 +1,47 @@
+package room
+
+// обработчики событий на шине сообщений
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/google/uuid"
+	"github.com/quizverse3D/Backend/internal/common"
+	"github.com/streadway/amqp"
+)
+
+// идемпотентен: при повторной доставке комнат пользователя уже нет, удалять нечего
+func UserDeletedHandler(service *Service) func(context.Context, amqp.Delivery) {
+	return func(ctx context.Context, msg amqp.Delivery) {
+		var payload struct {
+			UserID string `json:"userId"`
+		}
+
+		if err := json.Unmarshal(msg.Body, &payload); err != nil {
+			common.Logf(ctx, "userDeleted msg parse error: %v", err)
+			msg.Nack(false, false)
+			return
+		}
+
+		userUuid, err := uuid.Parse(payload.UserID)
+		if err != nil {
+			common.Logf(ctx, "userDeleted invalid userId: %v", err)
+			msg.Nack(false, false)
+			return
+		}
+
+		deleted, err := service.DeleteRoomsByOwner(ctx, userUuid)
+		if err != nil {
+			// ошибка БД временная, возвращаем в очередь
+			common.Logf(ctx, "userDeleted rooms deletion error: %v", err)
+			msg.Nack(false, true)
+			return
+		}
+		if deleted > 0 {
+			common.Logf(ctx, "deleted %d rooms of user %s", deleted, userUuid)
+		}
+
+		msg.Ack(false)
+	}
+}
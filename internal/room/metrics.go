@@ -0,0 +1,18 @@
+package room
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	roomsCreated = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "room_rooms_created_total",
+		Help: "Созданные комнаты",
+	})
+	// reason: owner — владелец или администратор, user_deleted — вместе с аккаунтом владельца
+	roomsDeleted = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "room_rooms_deleted_total",
+		Help: "Удалённые комнаты",
+	}, []string{"reason"})
+)
@@ -2,10 +2,9 @@ package room
 
 import (
 	"context"
-	"fmt"
-	"log"
 
 	"github.com/google/uuid"
+	"github.com/quizverse3D/Backend/internal/common"
 	pb "github.com/quizverse3D/Backend/internal/pb/room"
 	"google.golang.org/protobuf/types/known/timestamppb"
 )
@@ -21,15 +20,19 @@ func NewGRPCServer(svc *Service) pb.RoomServiceServer {
 
 func (s *Server) CreateRoom(ctx context.Context, req *pb.CreateRoomParamsRequest) (*pb.CreateRoomParamsResponse, error) {
 	// parse pb
-	userUuid, err := uuid.Parse(req.GetUserUuid())
+	userID, err := common.CallerUserID(ctx, req.GetUserUuid())
 	if err != nil {
-		return nil, fmt.Errorf("invalid user_uuid: %w", err)
+		return nil, err
+	}
+	userUuid, err := uuid.Parse(userID)
+	if err != nil {
+		return nil, ErrInvalidUserUuid
 	}
 
 	// call service
 	room, err := s.svc.CreateRoom(ctx, userUuid, &req.Name, req.Password, &req.MaxPlayers, &req.IsPublic)
 	if err != nil {
-		log.Printf("failed to create room: %v", err)
+		common.Logf(ctx, "failed to create room: %v", err)
 		return nil, err
 	}
 
@@ -47,12 +50,12 @@ func (s *Server) GetRoomById(ctx context.Context, req *pb.GetRoomParamsRequest)
 	// parse pb
 	id, err := uuid.Parse(req.GetId())
 	if err != nil {
-		return nil, fmt.Errorf("invalid id: %w", err)
+		return nil, ErrInvalidRoomID
 	}
 
 	room, err := s.svc.GetRoomById(ctx, id, true)
 	if err != nil {
-		log.Printf("failed to get room info: %v", err)
+		common.Logf(ctx, "failed to get room info: %v", err)
 		return nil, err
 	}
 
@@ -98,7 +101,7 @@ func (s *Server) SearchRooms(ctx context.Context, req *pb.SearchRoomsRequest) (*
 
 	rooms, total, err := s.svc.SearchRooms(ctx, searchPtr, page, size)
 	if err != nil {
-		log.Printf("failed to search rooms: %v", err)
+		common.Logf(ctx, "failed to search rooms: %v", err)
 		return nil, err
 	}
 
@@ -129,15 +132,19 @@ func (s *Server) SearchRooms(ctx context.Context, req *pb.SearchRoomsRequest) (*
 func (s *Server) DeleteRoom(ctx context.Context, req *pb.DeleteRoomRequest) (*pb.DeleteRoomResponse, error) {
 	roomID, err := uuid.Parse(req.GetId())
 	if err != nil {
-		return nil, fmt.Errorf("invalid id: %w", err)
+		return nil, ErrInvalidRoomID
+	}
+	userID, err := common.CallerUserID(ctx, req.GetUserUuid())
+	if err != nil {
+		return nil, err
 	}
-	userUuid, err := uuid.Parse(req.GetUserUuid())
+	userUuid, err := uuid.Parse(userID)
 	if err != nil {
-		return nil, fmt.Errorf("invalid user_uuid: %w", err)
+		return nil, ErrInvalidUserUuid
 	}
 
 	if err := s.svc.DeleteRoom(ctx, userUuid, roomID); err != nil {
-		log.Printf("failed to delete room: %v", err)
+		common.Logf(ctx, "failed to delete room: %v", err)
 		return nil, err
 	}
 
@@ -0,0 +1,68 @@
+package room
+
+import (
+	"context"
+	"testing"
+
+	"github.com/quizverse3D/Backend/internal/common"
+	pb "github.com/quizverse3D/Backend/internal/pb/room"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	callerUuid  = "6f1c3a7e-2b0d-4c55-9a8e-0f3b9d2e7c11"
+	foreignUuid = "0b7d9e24-5a61-4f3c-8d2e-7c9a1b3f5e60"
+	roomUuid    = "a3e5c7d9-1b2f-4a6c-8e0d-2f4b6d8a0c1e"
+)
+
+// пользователь берётся из токена: чужой user_uuid отклоняется до обращения к хранилищу
+func TestServerRejectsForeignUserUuid(t *testing.T) {
+	s := &Server{}
+	withCaller := common.ContextWithCaller(context.Background(), common.Caller{UserID: callerUuid})
+
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		call     func(ctx context.Context) (any, error)
+		wantCode codes.Code
+	}{
+		{
+			name: "create room for another user",
+			ctx:  withCaller,
+			call: func(ctx context.Context) (any, error) {
+				return s.CreateRoom(ctx, &pb.CreateRoomParamsRequest{UserUuid: foreignUuid, Name: "quiz", MaxPlayers: 4})
+			},
+			wantCode: codes.PermissionDenied,
+		},
+		{
+			name: "delete room as another user",
+			ctx:  withCaller,
+			call: func(ctx context.Context) (any, error) {
+				return s.DeleteRoom(ctx, &pb.DeleteRoomRequest{Id: roomUuid, UserUuid: foreignUuid})
+			},
+			wantCode: codes.PermissionDenied,
+		},
+		{
+			name: "no authenticated caller",
+			ctx:  context.Background(),
+			call: func(ctx context.Context) (any, error) {
+				return s.DeleteRoom(ctx, &pb.DeleteRoomRequest{Id: roomUuid, UserUuid: callerUuid})
+			},
+			wantCode: codes.Unauthenticated,
+		},
+	}
+
+	interceptor := common.ErrorStatusUnaryInterceptor("room", ErrorStatuses)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := interceptor(tt.ctx, nil, &grpc.UnaryServerInfo{}, func(ctx context.Context, _ any) (any, error) {
+				return tt.call(ctx)
+			})
+			if got := status.Code(err); got != tt.wantCode {
+				t.Fatalf("code = %v (%v), want %v", got, err, tt.wantCode)
+			}
+		})
+	}
+}
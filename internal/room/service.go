@@ -2,30 +2,22 @@ package room
 
 import (
 	"context"
-	"crypto/rand"
-	"encoding/base64"
+	"errors"
 	"strings"
 
 	"github.com/google/uuid"
+	"github.com/quizverse3D/Backend/internal/common"
 	"github.com/redis/go-redis/v9"
-	"golang.org/x/crypto/bcrypt"
 )
 
 type Service struct {
 	storage     *Storage
 	redisClient *redis.Client
+	hasher      *common.PasswordHasher
 }
 
-func NewService(storage *Storage, redisClient *redis.Client) *Service {
-	return &Service{storage: storage, redisClient: redisClient}
-}
-
-func generateSalt(n int) (string, error) {
-	b := make([]byte, n)
-	if _, err := rand.Read(b); err != nil {
-		return "", err
-	}
-	return base64.StdEncoding.EncodeToString(b), nil
+func NewService(storage *Storage, redisClient *redis.Client, hasher *common.PasswordHasher) *Service {
+	return &Service{storage: storage, redisClient: redisClient, hasher: hasher}
 }
 
 func (s *Service) CreateRoom(ctx context.Context, userUuid uuid.UUID, name *string, password *string, maxPlayers *int32, isPublic *bool) (*Room, error) {
@@ -38,27 +30,21 @@ func (s *Service) CreateRoom(ctx context.Context, userUuid uuid.UUID, name *stri
 	if isPublic == nil {
 		return nil, ErrInvalidIsPublic
 	}
+	// PHC-строка argon2id, соль внутри хеша; password_salt заполнен только у старых комнат с bcrypt
 	var passwordHash *string
-	var passwordSalt string
 	if password != nil {
-		ps, err := generateSalt(12)
+		hashString, err := s.hasher.Hash(*password)
 		if err != nil {
 			return nil, err
 		}
-		passwordSalt = ps
-		combined := *password + passwordSalt
-		hashByte, err := bcrypt.GenerateFromPassword([]byte(combined), bcrypt.DefaultCost)
-		if err != nil {
-			return nil, err
-		}
-		hashString := string(hashByte)
 		passwordHash = &hashString
 	}
 
-	room, err := s.storage.CreateRoom(ctx, Room{OwnerUuid: userUuid, Name: *name, PasswordHash: passwordHash, PasswordSalt: passwordSalt, MaxPlayers: *maxPlayers, IsPublic: *isPublic})
+	room, err := s.storage.CreateRoom(ctx, Room{OwnerUuid: userUuid, Name: *name, PasswordHash: passwordHash, MaxPlayers: *maxPlayers, IsPublic: *isPublic})
 	if err != nil {
 		return nil, err
 	}
+	roomsCreated.Inc()
 	ownerUsername, _ := s.redisClient.Get(ctx, "username:"+room.OwnerUuid.String()).Result()
 	room.OwnerName = ownerUsername
 
@@ -74,8 +60,9 @@ func (s *Service) GetRoomById(ctx context.Context, uuid uuid.UUID, isHiddenPassw
 		room.PasswordHash = nil
 		room.PasswordSalt = ""
 	}
+	// имени владельца может не быть в Redis, комната отдаётся без него
 	room.OwnerName, err = s.redisClient.Get(ctx, "username:"+room.OwnerUuid.String()).Result()
-	if err != nil {
+	if err != nil && !errors.Is(err, redis.Nil) {
 		return nil, err
 	}
 	return room, nil
@@ -128,8 +115,25 @@ func (s *Service) DeleteRoom(ctx context.Context, userUuid, roomUuid uuid.UUID)
 	if err != nil {
 		return err
 	}
-	if room.OwnerUuid != userUuid {
+	// администратор и модератор могут удалить любую комнату
+	caller, _ := common.CallerFromContext(ctx)
+	if room.OwnerUuid != userUuid && !caller.HasRole(common.RoleAdmin, common.RoleModerator) {
 		return ErrRoomForbidden
 	}
-	return s.storage.DeleteRoom(ctx, roomUuid)
+	if err := s.storage.DeleteRoom(ctx, roomUuid); err != nil {
+		return err
+	}
+	roomsDeleted.WithLabelValues("owner").Inc()
+	return nil
+}
+
+// комнаты удалённого пользователя: участники хранятся только в Redis на время игры,
+// передать владение некому, поэтому комнаты удаляются
+func (s *Service) DeleteRoomsByOwner(ctx context.Context, ownerUuid uuid.UUID) (int64, error) {
+	deleted, err := s.storage.DeleteRoomsByOwner(ctx, ownerUuid)
+	if err != nil {
+		return 0, err
+	}
+	roomsDeleted.WithLabelValues("user_deleted").Add(float64(deleted))
+	return deleted, nil
 }
@@ -2,8 +2,11 @@ package room
 
 import (
 	"context"
+	"errors"
+	"fmt"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -33,9 +36,13 @@ func (s *Storage) CreateRoom(ctx context.Context, room Room) (*Room, error) {
 func (s *Storage) GetRoomById(ctx context.Context, uuid uuid.UUID) (*Room, error) {
 	row := s.pool.QueryRow(ctx, `SELECT id, name, owner_id, password_hash, password_salt, max_players, created_at, is_public FROM rooms WHERE id = $1`, uuid.String())
 	var r Room
-	if err := row.Scan(&r.ID, &r.Name, &r.OwnerUuid, &r.PasswordHash, &r.PasswordSalt, &r.MaxPlayers, &r.CreatedAt, &r.IsPublic); err != nil {
+	err := row.Scan(&r.ID, &r.Name, &r.OwnerUuid, &r.PasswordHash, &r.PasswordSalt, &r.MaxPlayers, &r.CreatedAt, &r.IsPublic)
+	if errors.Is(err, pgx.ErrNoRows) {
 		return nil, ErrRoomNotFound
 	}
+	if err != nil {
+		return nil, fmt.Errorf("get room %s: %w", uuid, err)
+	}
 	return &r, nil
 }
 
@@ -87,3 +94,11 @@ func (s *Storage) DeleteRoom(ctx context.Context, id uuid.UUID) error {
 	}
 	return nil
 }
+
+func (s *Storage) DeleteRoomsByOwner(ctx context.Context, ownerID uuid.UUID) (int64, error) {
+	tag, err := s.pool.Exec(ctx, `DELETE FROM rooms WHERE owner_id = $1`, ownerID)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
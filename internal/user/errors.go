@@ -1,6 +1,11 @@
 package user
 
-import "errors"
+import (
+	"errors"
+
+	"github.com/quizverse3D/Backend/internal/common"
+	"google.golang.org/grpc/codes"
+)
 
 var (
 	ErrUserNotFound                 = errors.New("user not found")
@@ -8,4 +13,15 @@ var (
 	ErrUserParamsInvalidLangCode    = errors.New("lang_code is invalid")
 	ErrUserParamsInvalidSoundVolume = errors.New("sound_volume is invalid")
 	ErrUsernameRedisSaveError       = errors.New("username was not saved to redis")
+	ErrInvalidUserUuid              = errors.New("user_uuid must be a valid uuid")
 )
+
+// gRPC-коды доменных ошибок; Reason — стабильный код ошибки для клиентов REST API
+var ErrorStatuses = []common.ErrorStatus{
+	{Err: ErrUserNotFound, Code: codes.NotFound, Reason: "USER_NOT_FOUND"},
+	{Err: ErrUserParamsNotFound, Code: codes.NotFound, Reason: "USER_PARAMS_NOT_FOUND"},
+	{Err: ErrUserParamsInvalidLangCode, Code: codes.InvalidArgument, Reason: "INVALID_LANG_CODE"},
+	{Err: ErrUserParamsInvalidSoundVolume, Code: codes.InvalidArgument, Reason: "INVALID_SOUND_VOLUME"},
+	{Err: ErrInvalidUserUuid, Code: codes.InvalidArgument, Reason: "INVALID_USER_UUID"},
+	{Err: common.ErrCallerMismatch, Code: codes.PermissionDenied, Reason: "USER_UUID_MISMATCH"},
+}
@@ -5,36 +5,76 @@ package user
 import (
 	"context"
 	"encoding/json"
-	"log"
 
 	"github.com/google/uuid"
+	"github.com/quizverse3D/Backend/internal/common"
 	"github.com/streadway/amqp"
 )
 
-func UserRegisteredHandler(service *Service) func(amqp.Delivery) {
-	return func(msg amqp.Delivery) {
+// идемпотентен: повторная доставка для уже созданного пользователя ничего не меняет
+func UserRegisteredHandler(service *Service) func(context.Context, amqp.Delivery) {
+	return func(ctx context.Context, msg amqp.Delivery) {
 		var payload struct {
 			UserID   string `json:"userId"`
 			UserName string `json:"userName"`
 		}
 
 		if err := json.Unmarshal(msg.Body, &payload); err != nil {
-			log.Printf("userRegistered msg parse error: %v", err)
+			common.Logf(ctx, "userRegistered msg parse error: %v", err)
+			msg.Nack(false, false)
+			return
+		}
+
+		userUuid, err := uuid.Parse(payload.UserID)
+		if err != nil {
+			common.Logf(ctx, "userRegistered invalid userId: %v", err)
 			msg.Nack(false, false)
 			return
 		}
 
 		user := &User{
-			ID:       uuid.MustParse(payload.UserID),
+			ID:       userUuid,
 			Username: payload.UserName,
 		}
 
-		if err := service.CreateUser(context.Background(), user); err != nil {
-			log.Printf("userRegistered user creation error: %v", err)
+		if err := service.CreateUser(ctx, user); err != nil {
+			// ошибка БД или Redis временная, возвращаем в очередь
+			common.Logf(ctx, "userRegistered user creation error: %v", err)
+			msg.Nack(false, true)
+			return
+		}
+
+		msg.Ack(false)
+	}
+}
+
+// идемпотентен: повторная доставка для уже удалённого пользователя просто подтверждается
+func UserDeletedHandler(service *Service) func(context.Context, amqp.Delivery) {
+	return func(ctx context.Context, msg amqp.Delivery) {
+		var payload struct {
+			UserID string `json:"userId"`
+		}
+
+		if err := json.Unmarshal(msg.Body, &payload); err != nil {
+			common.Logf(ctx, "userDeleted msg parse error: %v", err)
 			msg.Nack(false, false)
 			return
 		}
 
+		userUuid, err := uuid.Parse(payload.UserID)
+		if err != nil {
+			common.Logf(ctx, "userDeleted invalid userId: %v", err)
+			msg.Nack(false, false)
+			return
+		}
+
+		if err := service.DeleteUser(ctx, userUuid); err != nil {
+			// ошибка БД или Redis временная, возвращаем в очередь
+			common.Logf(ctx, "userDeleted user deletion error: %v", err)
+			msg.Nack(false, true)
+			return
+		}
+
 		msg.Ack(false)
 	}
 }
@@ -0,0 +1,50 @@
+package user
+
+import (
+	"context"
+	"testing"
+
+	"github.com/streadway/amqp"
+)
+
+// запоминает, чем обработчик завершил доставку
+type recordingAcknowledger struct {
+	acked, nacked, requeued bool
+}
+
+func (a *recordingAcknowledger) Ack(tag uint64, multiple bool) error {
+	a.acked = true
+	return nil
+}
+
+func (a *recordingAcknowledger) Nack(tag uint64, multiple, requeue bool) error {
+	a.nacked, a.requeued = true, requeue
+	return nil
+}
+
+func (a *recordingAcknowledger) Reject(tag uint64, requeue bool) error {
+	return a.Nack(tag, false, requeue)
+}
+
+// битые сообщения отбрасываются без возврата в очередь и не доходят до сервиса
+func TestUserRegisteredHandlerDropsMalformed(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"invalid json", `{"userId":`},
+		{"invalid user id", `{"userId":"not-a-uuid","userName":"u"}`},
+		{"missing user id", `{"userName":"u"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ack := &recordingAcknowledger{}
+			UserRegisteredHandler(nil)(context.Background(), amqp.Delivery{Acknowledger: ack, Body: []byte(tt.body)})
+
+			if ack.acked || !ack.nacked || ack.requeued {
+				t.Errorf("ack = %+v, want nack without requeue", *ack)
+			}
+		})
+	}
+}
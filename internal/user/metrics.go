@@ -0,0 +1,17 @@
+package user
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	usersCreated = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "user_profiles_created_total",
+		Help: "Обработанные события user_registered, повторные доставки учитываются",
+	})
+	usersDeleted = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "user_profiles_deleted_total",
+		Help: "Обработанные события user_deleted, повторные доставки учитываются",
+	})
+)
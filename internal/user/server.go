@@ -2,10 +2,9 @@ package user
 
 import (
 	"context"
-	"fmt"
-	"log"
 
 	"github.com/google/uuid"
+	"github.com/quizverse3D/Backend/internal/common"
 	pb "github.com/quizverse3D/Backend/internal/pb/user"
 )
 
@@ -21,7 +20,7 @@ func NewGRPCServer(svc *Service) pb.UserServiceServer {
 func (s *Server) GetUser(ctx context.Context, req *pb.GetUserRequest) (*pb.GetUserResponse, error) {
 	user, err := s.svc.GetUser(ctx, req.GetUserId())
 	if err != nil {
-		log.Printf("failed to get user: %v", err)
+		common.Logf(ctx, "failed to get user: %v", err)
 		return nil, err
 	}
 
@@ -32,9 +31,18 @@ func (s *Server) GetUser(ctx context.Context, req *pb.GetUserRequest) (*pb.GetUs
 }
 
 func (s *Server) GetUserClientParams(ctx context.Context, req *pb.GetUserClientParamsRequest) (*pb.GetUserClientParamsResponse, error) {
-	params, err := s.svc.GetUserClientParamsByUuid(ctx, uuid.MustParse(req.GetUserUuid()))
+	userID, err := common.CallerUserID(ctx, req.GetUserUuid())
 	if err != nil {
-		log.Printf("failed to get user client params: %v", err)
+		return nil, err
+	}
+	userUuid, err := uuid.Parse(userID)
+	if err != nil {
+		return nil, ErrInvalidUserUuid
+	}
+
+	params, err := s.svc.GetUserClientParamsByUuid(ctx, userUuid)
+	if err != nil {
+		common.Logf(ctx, "failed to get user client params: %v", err)
 		return nil, err
 	}
 
@@ -48,9 +56,13 @@ func (s *Server) GetUserClientParams(ctx context.Context, req *pb.GetUserClientP
 
 func (s *Server) SetUserClientParams(ctx context.Context, req *pb.SetUserClientParamsRequest) (*pb.SetUserClientParamsResponse, error) {
 	// parse pb
-	userUuid, err := uuid.Parse(req.GetUserUuid())
+	userID, err := common.CallerUserID(ctx, req.GetUserUuid())
+	if err != nil {
+		return nil, err
+	}
+	userUuid, err := uuid.Parse(userID)
 	if err != nil {
-		return nil, fmt.Errorf("invalid user_uuid: %w", err)
+		return nil, ErrInvalidUserUuid
 	}
 	// * to disable goland type auto default values
 	var langCode *string
@@ -71,7 +83,7 @@ func (s *Server) SetUserClientParams(ctx context.Context, req *pb.SetUserClientP
 	// call service
 	params, err := s.svc.SetUserClientParamsByUuid(ctx, userUuid, langCode, soundVolume, isGameSoundEnabled)
 	if err != nil {
-		log.Printf("failed to set user client params: %v", err)
+		common.Logf(ctx, "failed to set user client params: %v", err)
 		return nil, err
 	}
 
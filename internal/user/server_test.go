@@ -0,0 +1,68 @@
+package user
+
+import (
+	"context"
+	"testing"
+
+	"github.com/quizverse3D/Backend/internal/common"
+	pb "github.com/quizverse3D/Backend/internal/pb/user"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+const (
+	callerUuid  = "6f1c3a7e-2b0d-4c55-9a8e-0f3b9d2e7c11"
+	foreignUuid = "0b7d9e24-5a61-4f3c-8d2e-7c9a1b3f5e60"
+)
+
+// пользователь берётся из токена: чужой user_uuid отклоняется до обращения к хранилищу
+func TestServerRejectsForeignUserUuid(t *testing.T) {
+	s := &Server{}
+	withCaller := common.ContextWithCaller(context.Background(), common.Caller{UserID: callerUuid})
+
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		call     func(ctx context.Context) (any, error)
+		wantCode codes.Code
+	}{
+		{
+			name: "read params of another user",
+			ctx:  withCaller,
+			call: func(ctx context.Context) (any, error) {
+				return s.GetUserClientParams(ctx, &pb.GetUserClientParamsRequest{UserUuid: foreignUuid})
+			},
+			wantCode: codes.PermissionDenied,
+		},
+		{
+			name: "write params of another user",
+			ctx:  withCaller,
+			call: func(ctx context.Context) (any, error) {
+				return s.SetUserClientParams(ctx, &pb.SetUserClientParamsRequest{UserUuid: foreignUuid, LangCode: wrapperspb.String("ru")})
+			},
+			wantCode: codes.PermissionDenied,
+		},
+		{
+			name: "no authenticated caller",
+			ctx:  context.Background(),
+			call: func(ctx context.Context) (any, error) {
+				return s.GetUserClientParams(ctx, &pb.GetUserClientParamsRequest{UserUuid: callerUuid})
+			},
+			wantCode: codes.Unauthenticated,
+		},
+	}
+
+	interceptor := common.ErrorStatusUnaryInterceptor("user", ErrorStatuses)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := interceptor(tt.ctx, nil, &grpc.UnaryServerInfo{}, func(ctx context.Context, _ any) (any, error) {
+				return tt.call(ctx)
+			})
+			if got := status.Code(err); got != tt.wantCode {
+				t.Fatalf("code = %v (%v), want %v", got, err, tt.wantCode)
+			}
+		})
+	}
+}
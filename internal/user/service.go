@@ -25,6 +25,7 @@ func (s *Service) CreateUser(ctx context.Context, u *User) error {
 	if err != nil {
 		return err
 	}
+	usersCreated.Inc()
 	err = s.SyncUsernamesToRedis(ctx, &u.ID)
 	if err != nil {
 		return ErrUsernameRedisSaveError
@@ -32,6 +33,14 @@ func (s *Service) CreateUser(ctx context.Context, u *User) error {
 	return nil
 }
 
+func (s *Service) DeleteUser(ctx context.Context, userUuid uuid.UUID) error {
+	if err := s.storage.DeleteUser(ctx, userUuid); err != nil {
+		return err
+	}
+	usersDeleted.Inc()
+	return s.redisClient.Del(ctx, "username:"+userUuid.String()).Err()
+}
+
 func (s *Service) GetUserClientParamsByUuid(ctx context.Context, userUuid uuid.UUID) (*ClientParams, error) {
 	return s.storage.GetUserClientParamsByUuid(ctx, userUuid)
 }
@@ -2,10 +2,12 @@ package user
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -22,9 +24,12 @@ func (s *Storage) GetUserByID(ctx context.Context, id string) (*User, error) {
 
 	var u User
 	err := row.Scan(&u.ID, &u.Username)
-	if err != nil {
+	if errors.Is(err, pgx.ErrNoRows) {
 		return nil, ErrUserNotFound
 	}
+	if err != nil {
+		return nil, err
+	}
 
 	return &u, nil
 }
@@ -47,13 +52,38 @@ func (s *Storage) GetAllUsers(ctx context.Context) ([]User, error) {
 	return users, rows.Err()
 }
 
+// идемпотентна: user_registered доставляется как минимум один раз и может прийти повторно
 func (s *Storage) CreateUser(ctx context.Context, u *User) error {
-	_, usersErr := s.pool.Exec(ctx, `INSERT INTO users (id, username) VALUES ($1, $2)`, u.ID, u.Username)
-	if usersErr != nil {
-		return usersErr
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return err
 	}
-	_, paramsErr := s.pool.Exec(ctx, `INSERT INTO params (user_uuid) VALUES ($1)`, u.ID)
-	return paramsErr
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `INSERT INTO users (id, username) VALUES ($1, $2) ON CONFLICT (id) DO NOTHING`, u.ID, u.Username); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `INSERT INTO params (user_uuid) VALUES ($1) ON CONFLICT (user_uuid) DO NOTHING`, u.ID); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// удаление профиля и параметров; повторный вызов для уже удалённого пользователя не ошибка
+func (s *Storage) DeleteUser(ctx context.Context, id uuid.UUID) error {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `DELETE FROM params WHERE user_uuid = $1`, id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM users WHERE id = $1`, id); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
 }
 
 func (s *Storage) GetUserClientParamsByUuid(ctx context.Context, uuid uuid.UUID) (*ClientParams, error) {
@@ -61,9 +91,12 @@ func (s *Storage) GetUserClientParamsByUuid(ctx context.Context, uuid uuid.UUID)
 
 	var p ClientParams
 	err := row.Scan(&p.UserUuid, &p.LangCode, &p.SoundVolume, &p.IsGameSoundEnabled)
-	if err != nil {
+	if errors.Is(err, pgx.ErrNoRows) {
 		return nil, ErrUserParamsNotFound
 	}
+	if err != nil {
+		return nil, err
+	}
 
 	return &p, nil
 }
@@ -1,6 +1,117 @@
 CREATE TABLE IF NOT EXISTS credentials (
     id UUID PRIMARY KEY,
-    email TEXT UNIQUE NOT NULL,
-    password TEXT NOT NULL,
-    password_salt TEXT NOT NULL
-);
\ No newline at end of file
+    email TEXT UNIQUE,
+    password TEXT, -- PHC-строка argon2id, у старых аккаунтов bcrypt
+    password_salt TEXT, -- только для старых bcrypt-хешей
+    verified BOOLEAN NOT NULL DEFAULT false,
+    is_guest BOOLEAN NOT NULL DEFAULT false,
+    roles TEXT[] NOT NULL DEFAULT '{user}',
+    -- только у гостей может не быть email и пароля
+    CHECK (is_guest OR (email IS NOT NULL AND password IS NOT NULL))
+);
+
+-- базы, созданные до появления столбцов: CREATE TABLE IF NOT EXISTS их не изменит
+
+-- подтверждение email: уже существующие аккаунты считаются подтверждёнными, новые — нет
+ALTER TABLE credentials ADD COLUMN IF NOT EXISTS verified BOOLEAN NOT NULL DEFAULT true;
+ALTER TABLE credentials ALTER COLUMN verified SET DEFAULT false;
+
+-- гостевые аккаунты без email и пароля
+ALTER TABLE credentials ADD COLUMN IF NOT EXISTS is_guest BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE credentials ALTER COLUMN email DROP NOT NULL;
+ALTER TABLE credentials ALTER COLUMN password DROP NOT NULL;
+
+-- роли RBAC
+ALTER TABLE credentials ADD COLUMN IF NOT EXISTS roles TEXT[] NOT NULL DEFAULT '{user}';
+
+-- argon2id хранит соль в PHC-строке, password_salt остаётся только у bcrypt-хешей
+ALTER TABLE credentials ALTER COLUMN password_salt DROP NOT NULL;
+ALTER TABLE credentials DROP CONSTRAINT IF EXISTS credentials_check;
+ALTER TABLE credentials ADD CONSTRAINT credentials_check
+    CHECK (is_guest OR (email IS NOT NULL AND password IS NOT NULL));
+
+-- почта уникальна без учёта регистра, поиск идёт по lower(email), новые адреса пишутся в нижнем регистре.
+-- Если в старой базе есть адреса, различающиеся только регистром, индекс не создастся:
+-- такие аккаунты нужно сначала объединить
+CREATE UNIQUE INDEX IF NOT EXISTS credentials_email_lower_idx ON credentials (lower(email));
+
+-- TOTP 2FA: секрет зашифрован AES-GCM ключом MFA_ENCRYPTION_KEY
+CREATE TABLE IF NOT EXISTS mfa (
+    user_id UUID PRIMARY KEY REFERENCES credentials(id) ON DELETE CASCADE,
+    secret TEXT NOT NULL,
+    enabled BOOLEAN NOT NULL DEFAULT false,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- одноразовые коды восстановления, хранится только sha256
+CREATE TABLE IF NOT EXISTS mfa_recovery_codes (
+    user_id UUID NOT NULL REFERENCES credentials(id) ON DELETE CASCADE,
+    code_hash TEXT NOT NULL,
+    used_at TIMESTAMPTZ,
+    PRIMARY KEY (user_id, code_hash)
+);
+-- персональные API-ключи для ботов и скриптов, хранится только sha256 ключа
+CREATE TABLE IF NOT EXISTS api_keys (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES credentials(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    prefix TEXT NOT NULL,
+    key_hash TEXT NOT NULL UNIQUE,
+    scopes TEXT[] NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    expires_at TIMESTAMPTZ,
+    last_used_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS api_keys_user_id_idx ON api_keys (user_id);
+
+-- transactional outbox: события пишутся в одной транзакции с данными, relay публикует их в RabbitMQ
+CREATE TABLE IF NOT EXISTS outbox (
+    id BIGSERIAL PRIMARY KEY,
+    exchange TEXT NOT NULL DEFAULT '',
+    routing_key TEXT NOT NULL,
+    payload BYTEA NOT NULL,
+    request_id TEXT, -- X-Request-ID запроса, породившего событие; уходит в заголовок x-request-id
+    traceparent TEXT, -- W3C trace context запроса: публикация события попадает в тот же трейс
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    locked_until TIMESTAMPTZ, -- аренда строки экземпляром relay на время публикации
+    sent_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS outbox_pending_idx ON outbox (id) WHERE sent_at IS NULL;
+CREATE INDEX IF NOT EXISTS outbox_sent_idx ON outbox (sent_at) WHERE sent_at IS NOT NULL;
+
+-- X-Request-ID для таблиц outbox, созданных до его появления
+ALTER TABLE outbox ADD COLUMN IF NOT EXISTS request_id TEXT;
+-- trace context для таблиц outbox, созданных до его появления
+ALTER TABLE outbox ADD COLUMN IF NOT EXISTS traceparent TEXT;
+-- аренда строк relay для таблиц outbox, созданных до её появления
+ALTER TABLE outbox ADD COLUMN IF NOT EXISTS locked_until TIMESTAMPTZ;
+
+-- журнал аудита: только добавление, user_id без внешнего ключа, чтобы записи переживали удаление аккаунта
+CREATE TABLE IF NOT EXISTS audit_log (
+    id BIGSERIAL PRIMARY KEY,
+    occurred_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    event TEXT NOT NULL,
+    outcome TEXT NOT NULL,
+    user_id UUID,
+    email TEXT,
+    ip TEXT NOT NULL,
+    user_agent TEXT NOT NULL,
+    details TEXT
+);
+
+CREATE INDEX IF NOT EXISTS audit_log_user_idx ON audit_log (user_id, id);
+CREATE INDEX IF NOT EXISTS audit_log_event_idx ON audit_log (event, id);
+CREATE INDEX IF NOT EXISTS audit_log_occurred_at_idx ON audit_log (occurred_at);
+
+CREATE OR REPLACE FUNCTION audit_log_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS audit_log_append_only ON audit_log;
+CREATE TRIGGER audit_log_append_only
+    BEFORE UPDATE OR DELETE ON audit_log
+    FOR EACH ROW EXECUTE FUNCTION audit_log_append_only();